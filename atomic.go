@@ -0,0 +1,133 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// sizes32 computes layouts on 32-bit platforms, where 64-bit words are only 4 bytes
+// aligned. The sync/atomic package requires callers to align them on 8 bytes there.
+var sizes32 = &sizes{
+	stdSizes: types.SizesFor("gc", "386"),
+	maxAlign: 4,
+}
+
+// atomicFields returns the struct fields whose address is passed to one of the
+// sync/atomic functions, like atomic.AddInt64(&s.n, 1).
+func atomicFields(pass *analysis.Pass) map[*types.Var]bool {
+	fields := make(map[*types.Var]bool)
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+			if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "sync/atomic" {
+				return true
+			}
+			addr, ok := astutil.Unparen(call.Args[0]).(*ast.UnaryExpr)
+			if !ok || addr.Op != token.AND {
+				return true
+			}
+			sel, ok := astutil.Unparen(addr.X).(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if s := pass.TypesInfo.Selections[sel]; s != nil && s.Kind() == types.FieldVal {
+				fields[s.Obj().(*types.Var)] = true
+			}
+			return true
+		})
+	}
+	return fields
+}
+
+// atomic64 returns the fields which are 64-bit words.
+func atomic64(fields map[*types.Var]bool) map[*types.Var]bool {
+	words := make(map[*types.Var]bool)
+	for f := range fields {
+		if b, ok := f.Type().Underlying().(*types.Basic); ok && (b.Kind() == types.Int64 || b.Kind() == types.Uint64) {
+			words[f] = true
+		}
+	}
+	return words
+}
+
+// misalignedAtomics returns the indexes of the fields accessed atomically which
+// are not 64-bit aligned on 32-bit platforms, and their offsets there.
+func misalignedAtomics(fields []*types.Var, atomic map[*types.Var]bool) (idx []int, offsets []int64) {
+	if len(atomic) == 0 {
+		return nil, nil
+	}
+	for i, off := range sizes32.Offsetsof(fields) {
+		if atomic[fields[i]] && off%8 != 0 {
+			idx = append(idx, i)
+			offsets = append(offsets, off)
+		}
+	}
+	return idx, offsets
+}
+
+// atomicFirst moves the fields accessed atomically at the start of the struct,
+// right after zero-sized fields, so they are 64-bit aligned on all platforms.
+func atomicFirst(sizes types.Sizes, s *types.Struct, atomic map[*types.Var]bool) *types.Struct {
+	var zero, first, rest []*types.Var
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		switch {
+		case sizes.Sizeof(f.Type()) == 0:
+			zero = append(zero, f)
+		case atomic[f]:
+			first = append(first, f)
+		default:
+			rest = append(rest, f)
+		}
+	}
+	fields := append(append(zero, first...), rest...)
+	return types.NewStruct(fields, nil)
+}
+
+// structFields returns the fields of s.
+func structFields(s *types.Struct) []*types.Var {
+	fields := make([]*types.Var, s.NumFields())
+	for i := range fields {
+		fields[i] = s.Field(i)
+	}
+	return fields
+}
+
+// fieldNodes returns, for every field of atyp, the node declaring it: its name, or
+// its type for embedded fields.
+func fieldNodes(atyp *ast.StructType) []ast.Node {
+	var nodes []ast.Node
+	for _, f := range atyp.Fields.List {
+		if len(f.Names) == 0 {
+			nodes = append(nodes, f.Type)
+			continue
+		}
+		for _, name := range f.Names {
+			nodes = append(nodes, name)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// baselineEntry is a known sloppy struct. Structs are identified by their package,
+// type name and set of fields, not by their position, so that entries survive
+// unrelated edits of the files declaring them.
+type baselineEntry struct {
+	Package          string   `json:"package"`
+	Type             string   `json:"type,omitempty"`
+	Fields           []string `json:"fields"`
+	SizeClass        int64    `json:"size_class"`
+	OptimalSizeClass int64    `json:"optimal_size_class"`
+}
+
+func (e baselineEntry) key() string {
+	return e.Package + "." + e.Type + "{" + strings.Join(e.Fields, "; ") + "}"
+}
+
+// wasted returns the bytes which could be saved by rearranging the struct.
+func (e baselineEntry) wasted() int64 {
+	return e.SizeClass - e.OptimalSizeClass
+}
+
+type baselineFile struct {
+	Structs []baselineEntry `json:"structs"`
+}
+
+// newBaselineEntry returns the baseline entry of a struct checked by r.
+func newBaselineEntry(pkgPath, typeName string, r result) baselineEntry {
+	fields := make([]string, r.optStruct.NumFields())
+	for i := range fields {
+		f := r.optStruct.Field(i)
+		fields[i] = f.Name() + " " + types.TypeString(f.Type(), nil)
+	}
+	sort.Strings(fields)
+	return baselineEntry{
+		Package:          pkgPath,
+		Type:             typeName,
+		Fields:           fields,
+		SizeClass:        r.oldRuntimeSize,
+		OptimalSizeClass: r.newRuntimeSize,
+	}
+}
+
+// baseline holds the entries of the -baseline file, loaded once, or, with
+// -write-baseline, the entries written to it.
+type baseline struct {
+	mu      sync.Mutex
+	path    string
+	writing bool
+	entries map[string]baselineEntry
+}
+
+var structsBaseline baseline
+
+// reset loads the baseline file for reading, or starts a new one for writing, when
+// the flags changed since the last call.
+func (b *baseline) reset() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.entries != nil && b.path == baselinePath && b.writing == writeBaseline {
+		return nil
+	}
+	b.path, b.writing, b.entries = baselinePath, writeBaseline, make(map[string]baselineEntry)
+	if b.writing {
+		return nil
+	}
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return fmt.Errorf("failed to read baseline: %w", err)
+	}
+	var f baselineFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("invalid baseline %s: %w", b.path, err)
+	}
+	for _, e := range f.Structs {
+		b.entries[e.key()] = e
+	}
+	return nil
+}
+
+// known reports whether the struct is in the baseline, and is not sloppier than it was.
+func (b *baseline) known(e baselineEntry) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old, ok := b.entries[e.key()]
+	return ok && e.SizeClass <= old.SizeClass && e.wasted() <= old.wasted()
+}
+
+// add records entries and rewrites the baseline file with all entries so far.
+func (b *baseline) add(entries []baselineEntry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range entries {
+		b.entries[e.key()] = e
+	}
+	f := baselineFile{Structs: make([]baselineEntry, 0, len(b.entries))}
+	for _, e := range b.entries {
+		f.Structs = append(f.Structs, e)
+	}
+	sort.Slice(f.Structs, func(i, j int) bool { return f.Structs[i].key() < f.Structs[j].key() })
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, append(data, '\n'), 0o644)
+}
+
+// checkBaseline validates the -baseline and -write-baseline flags.
+func checkBaseline() error {
+	if writeBaseline && baselinePath == "" {
+		return errors.New("-write-baseline requires -baseline")
+	}
+	if baselinePath == "" {
+		return nil
+	}
+	return structsBaseline.reset()
+}
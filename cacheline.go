@@ -0,0 +1,189 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// contention records why struct fields are contended between goroutines.
+type contention struct {
+	atomic     map[*types.Var]bool  // accessed with sync/atomic functions
+	goroutines map[*types.Var][]int // indexes of the go statements starting functions accessing the field
+}
+
+// goroutineFields returns the struct fields accessed from functions started by a
+// go statement, with the indexes of the statements starting them. The functions
+// are function literals, or functions and methods of the package, like go s.loop(),
+// and are followed into the functions of the package they call.
+func goroutineFields(pass *analysis.Pass) map[*types.Var][]int {
+	bodies := make(map[*types.Func]*ast.BlockStmt)
+	var stmts []*ast.GoStmt
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if fn, ok := pass.TypesInfo.Defs[n.Name].(*types.Func); ok && n.Body != nil {
+					bodies[fn] = n.Body
+				}
+			case *ast.GoStmt:
+				stmts = append(stmts, n)
+			}
+			return true
+		})
+	}
+	callee := func(call *ast.CallExpr) *ast.BlockStmt {
+		if fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func); ok {
+			return bodies[fn.Origin()]
+		}
+		return nil
+	}
+
+	fields := make(map[*types.Var][]int)
+	for i, g := range stmts {
+		seen := make(map[*ast.BlockStmt]bool)
+		var visit func(body *ast.BlockStmt)
+		visit = func(body *ast.BlockStmt) {
+			if body == nil || seen[body] {
+				return
+			}
+			seen[body] = true
+			ast.Inspect(body, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.GoStmt:
+					// Started in another goroutine.
+					return false
+				case *ast.SelectorExpr:
+					if s := pass.TypesInfo.Selections[n]; s != nil && s.Kind() == types.FieldVal {
+						v := s.Obj().(*types.Var)
+						if ids := fields[v]; len(ids) == 0 || ids[len(ids)-1] != i {
+							fields[v] = append(ids, i)
+						}
+					}
+				case *ast.CallExpr:
+					visit(callee(n))
+				}
+				return true
+			})
+		}
+		// The arguments of the call are evaluated by the goroutine executing the
+		// go statement, so only the called function is visited.
+		if lit, ok := astutil.Unparen(g.Call.Fun).(*ast.FuncLit); ok {
+			visit(lit.Body)
+		} else {
+			visit(callee(g.Call))
+		}
+	}
+	return fields
+}
+
+// hotReason returns why field f is contended, or an empty string if it is not.
+func (c contention) hotReason(f *types.Var) string {
+	switch {
+	case isSyncType(f.Type(), "sync", "Mutex", "RWMutex"):
+		return "mutex"
+	case c.atomic[f] || isSyncType(f.Type(), "sync/atomic", ""):
+		return "atomic"
+	case len(c.goroutines[f]) > 0:
+		return "goroutine"
+	}
+	return ""
+}
+
+// shared reports whether the contended fields a and b may be accessed by different
+// goroutines. Fields only accessed from the functions started by the same go
+// statement are not.
+func (c contention) shared(a, b *types.Var) bool {
+	if c.hotReason(a) != "goroutine" || c.hotReason(b) != "goroutine" {
+		return true
+	}
+	for _, i := range c.goroutines[a] {
+		for _, j := range c.goroutines[b] {
+			if i != j {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSyncType reports whether T is one of the named types of package path. With an
+// empty name, any type of the package matches.
+func isSyncType(T types.Type, path string, names ...string) bool {
+	named, ok := T.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	if obj.Pkg() == nil || obj.Pkg().Path() != path {
+		return false
+	}
+	for _, name := range names {
+		if name == "" || name == obj.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// falseSharing reports contended fields of a struct which share a cache line with
+// a previous contended field, accessed by another goroutine.
+func falseSharing(pass *analysis.Pass, sizes types.Sizes, name string, atyp *ast.StructType, styp *types.Struct, c contention, lineSize int64) {
+	fields := structFields(styp)
+	offsets := sizes.Offsetsof(fields)
+	nodes := fieldNodes(atyp)
+	var hot []int
+	for i, f := range fields {
+		reason := c.hotReason(f)
+		if reason == "" {
+			continue
+		}
+		// Look for the closest previous field whose last byte is on the cache line
+		// this field starts on.
+		for k := len(hot) - 1; k >= 0; k-- {
+			prev := hot[k]
+			prevEnd := offsets[prev] + sizes.Sizeof(fields[prev].Type())
+			if prevEnd == 0 || (prevEnd-1)/lineSize != offsets[i]/lineSize {
+				break
+			}
+			if !c.shared(fields[prev], f) {
+				continue
+			}
+			pass.Report(analysis.Diagnostic{
+				Pos:      nodes[i].Pos(),
+				Category: categoryFalseSharing,
+				Message: fmt.Sprintf(
+					"%s: field %s (%s) shares a %d bytes cache line with field %s (%s), which may cause false sharing, add %d bytes of padding before %s or move the fields apart",
+					name,
+					f.Name(),
+					reason,
+					lineSize,
+					fields[prev].Name(),
+					c.hotReason(fields[prev]),
+					align(prevEnd, lineSize)-offsets[i],
+					f.Name(),
+				),
+			})
+			break
+		}
+		hot = append(hot, i)
+	}
+}
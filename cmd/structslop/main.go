@@ -15,11 +15,58 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
 	"golang.org/x/tools/go/analysis/singlechecker"
 
 	"github.com/orijtech/structslop"
 )
 
 func main() {
-	singlechecker.Main(structslop.Analyzer)
+	if os.Getenv(structslop.DeferredOutputEnv) != "" {
+		singlechecker.Main(structslop.Analyzer)
+	}
+	os.Exit(run())
+}
+
+// run runs the analysis in a child process, as the analysis driver exits when it
+// is done, then prints what the analysis deferred to the end of the run, like the
+// summary, and returns the exit code of the analysis.
+func run() int {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	f, err := os.CreateTemp("", "structslop-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), structslop.DeferredOutputEnv+"="+f.Name())
+	code := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if code = exitErr.ExitCode(); code < 0 {
+			code = 1 // killed by a signal
+		}
+	}
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return code
 }
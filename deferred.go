@@ -0,0 +1,61 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// DeferredOutputEnv names the environment variable holding the path of the file
+// the analysis writes what is to be printed once all packages are analyzed to.
+// There is no hook at the end of the analysis, so the file is rewritten after
+// every package, and cmd/structslop prints it when the analysis driver is done.
+// It holds the summary, unless written to -summary, as a table, or as the last
+// JSON record with -format=json, after the JSON records ranked with -heap-profile.
+const DeferredOutputEnv = "STRUCTSLOP_DEFERRED_OUTPUT"
+
+// deferredOutputMu serializes the writes of the deferred output of packages
+// analyzed concurrently.
+var deferredOutputMu sync.Mutex
+
+// writeDeferredOutput rewrites the file named by DeferredOutputEnv, if set.
+func writeDeferredOutput() error {
+	path := os.Getenv(DeferredOutputEnv)
+	if path == "" {
+		return nil
+	}
+	deferredOutputMu.Lock()
+	defer deferredOutputMu.Unlock()
+	var buf bytes.Buffer
+	if outputFormat == formatJSON && output == "" && heapProfilePath != "" {
+		if err := writeJSONLines(&buf, structuredReport.all()); err != nil {
+			return err
+		}
+	}
+	if sum := moduleSummary.current(); sum != nil && len(sum.Packages) > 0 {
+		switch {
+		case outputFormat == formatJSON && output == "":
+			if err := json.NewEncoder(&buf).Encode(summaryRecord{Summary: *sum}); err != nil {
+				return err
+			}
+		case outputFormat == formatText && summaryPath == "":
+			buf.WriteString(sum.String())
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// diffContext is the number of unchanged lines around the changes of a hunk.
+const diffContext = 3
+
+// diffPrinter prints the diffs of -print-diff to standard output. Packages are
+// analyzed concurrently, and test variants of packages repeat the same fixes, so
+// every diff is printed once, as a whole.
+type diffPrinter struct {
+	mu      sync.Mutex
+	printed map[string]bool
+}
+
+var fixDiffs diffPrinter
+
+// printFixes prints the unified diff of the files changed by the suggested fixes
+// of diags, sorted by file name.
+func printFixes(fset *token.FileSet, diags []analysis.Diagnostic) error {
+	var diffs []string
+	for f, edits := range fixEdits(fset, diags) {
+		src, err := os.ReadFile(f.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if d := unifiedDiff(relPath(f.Name()), src, applyEdits(f, src, edits)); d != "" {
+			diffs = append(diffs, d)
+		}
+	}
+	sort.Strings(diffs)
+
+	fixDiffs.mu.Lock()
+	defer fixDiffs.mu.Unlock()
+	if fixDiffs.printed == nil {
+		fixDiffs.printed = make(map[string]bool)
+	}
+	for _, d := range diffs {
+		if fixDiffs.printed[d] {
+			continue
+		}
+		fixDiffs.printed[d] = true
+		if _, err := os.Stdout.WriteString(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffOp is a line of a diff: kept, deleted from the old file or inserted in the
+// new one.
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns the unified diff from old to new, or "" if they are equal.
+func unifiedDiff(name string, old, new []byte) string {
+	if bytes.Equal(old, new) {
+		return ""
+	}
+	ops := diffLines(splitLines(old), splitLines(new))
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", name, name)
+	oldLine, newLine := 1, 1 // of ops[i]
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			oldLine++
+			newLine++
+			continue
+		}
+		// Extend the hunk over changes separated by at most twice the context.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			kept := end
+			for kept < len(ops) && ops[kept].kind == ' ' {
+				kept++
+			}
+			if kept == len(ops) || kept-end > 2*diffContext {
+				if kept-end > diffContext {
+					kept = end + diffContext
+				}
+				end = kept
+				break
+			}
+			end = kept
+		}
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+		var oldCount, newCount int
+		var lines strings.Builder
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+			lines.WriteByte(op.kind)
+			lines.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				lines.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		b.WriteString(lines.String())
+		for _, op := range ops[i:end] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the start and number of lines of a hunk. Empty ranges start
+// at the line before them.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits src after every newline.
+func splitLines(src []byte) []string {
+	var lines []string
+	for len(src) > 0 {
+		i := bytes.IndexByte(src, '\n') + 1
+		if i == 0 {
+			i = len(src)
+		}
+		lines = append(lines, string(src[:i]))
+		src = src[i:]
+	}
+	return lines
+}
+
+// diffLines returns a shortest edit script from a to b, using Myers' algorithm,
+// which is fast when they have few differences, like rearranged struct fields.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[max+k-1] < v[max+k+1] {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d, max)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the trace of diffLines back from the end of a and b.
+func backtrack(a, b []string, trace [][]int, d, max int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for ; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[max+k-1] < v[max+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[max+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(n int) []string {
+		var l []string
+		for i := 1; i <= n; i++ {
+			l = append(l, strings.Repeat("x", i))
+		}
+		return l
+	}
+	join := func(l []string) string { return strings.Join(l, "\n") + "\n" }
+	swapped := lines(20)
+	swapped[1], swapped[2] = swapped[2], swapped[1]
+	swapped[17], swapped[18] = swapped[18], swapped[17]
+
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{
+			"swap",
+			"type s struct {\n\tx uint32\n\ty uint64\n\tz uint32\n}\n",
+			"type s struct {\n\ty uint64\n\tx uint32\n\tz uint32\n}\n",
+			"--- a/p.go\n+++ b/p.go\n@@ -1,5 +1,5 @@\n type s struct {\n-\tx uint32\n \ty uint64\n+\tx uint32\n \tz uint32\n }\n",
+		},
+		{
+			"two hunks",
+			join(lines(20)),
+			join(swapped),
+			"--- a/p.go\n+++ b/p.go\n@@ -1,6 +1,6 @@\n x\n-xx\n xxx\n+xx\n xxxx\n xxxxx\n xxxxxx\n" +
+				"@@ -15,6 +15,6 @@\n" + strings.Join([]string{
+				" " + strings.Repeat("x", 15),
+				" " + strings.Repeat("x", 16),
+				" " + strings.Repeat("x", 17),
+				"-" + strings.Repeat("x", 18),
+				" " + strings.Repeat("x", 19),
+				"+" + strings.Repeat("x", 18),
+				" " + strings.Repeat("x", 20),
+			}, "\n") + "\n",
+		},
+		{
+			"no newline at end of file",
+			"a\nb",
+			"a\nc",
+			"--- a/p.go\n+++ b/p.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			"insert into empty file",
+			"",
+			"a\n",
+			"--- a/p.go\n+++ b/p.go\n@@ -0,0 +1 @@\n+a\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := unifiedDiff("p.go", []byte(tt.old), []byte(tt.new)); got != tt.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", tt.name, got, tt.want)
+		}
+	}
+}
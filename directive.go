@@ -0,0 +1,138 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+const (
+	// ignoreDirective on a type declaration skips all structs declared by it.
+	ignoreDirective = "//structslop:ignore"
+	// pinDirective on a struct field keeps the field at its current position.
+	pinDirective = "//structslop:pin"
+)
+
+// hasDirective reports whether the comment group contains the given directive,
+// optionally followed by an explanation, like "//structslop:ignore order matters".
+func hasDirective(cg *ast.CommentGroup, directive string) bool {
+	if cg == nil {
+		return false
+	}
+	for _, c := range cg.List {
+		if c.Text == directive || strings.HasPrefix(c.Text, directive+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredRange is the source range of a type declaration with an ignore directive.
+type ignoredRange struct {
+	pos, end token.Pos
+}
+
+// ignoredTypes returns the ranges of type declarations with an ignore directive.
+func ignoredTypes(files []*ast.File) []ignoredRange {
+	var ranges []ignoredRange
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			ast.Inspect(decl, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.GenDecl:
+					if n.Tok == token.TYPE && hasDirective(n.Doc, ignoreDirective) {
+						ranges = append(ranges, ignoredRange{n.Pos(), n.End()})
+						return false
+					}
+				case *ast.TypeSpec:
+					if hasDirective(n.Doc, ignoreDirective) || hasDirective(n.Comment, ignoreDirective) {
+						ranges = append(ranges, ignoredRange{n.Pos(), n.End()})
+						return false
+					}
+				}
+				return true
+			})
+		}
+	}
+	return ranges
+}
+
+// isIgnored reports whether n is part of an ignored type declaration.
+func isIgnored(ranges []ignoredRange, n ast.Node) bool {
+	for _, r := range ranges {
+		if r.pos <= n.Pos() && n.End() <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// pinnedFields reports, for every field of atyp, whether it has a pin directive.
+// Fields declared with many names are all pinned.
+func pinnedFields(atyp *ast.StructType) []bool {
+	var pinned []bool
+	for _, f := range atyp.Fields.List {
+		pin := hasDirective(f.Doc, pinDirective) || hasDirective(f.Comment, pinDirective)
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			pinned = append(pinned, pin)
+		}
+	}
+	return pinned
+}
+
+// pinnedStructArrangement returns the best arrangement found which keeps pinned
+// fields at their position, moving the other ones around them.
+func pinnedStructArrangement(sizes types.Sizes, m map[*types.Var]int, pinned []bool) *types.Struct {
+	fields := make([]*types.Var, len(m))
+	for v, i := range m {
+		fields[i] = v
+	}
+	free := make(map[*types.Var]int)
+	for i, f := range fields {
+		if !pinned[i] {
+			free[f] = len(free)
+		}
+	}
+	opt := optimalStructArrangement(sizes, free)
+
+	// Fill the free positions both in optimal order and in reverse order, as
+	// smaller fields may pack better after a pinned small field.
+	fill := func(next func(k int) *types.Var) *types.Struct {
+		arranged := make([]*types.Var, len(fields))
+		k := 0
+		for i, f := range fields {
+			if pinned[i] {
+				arranged[i] = f
+				continue
+			}
+			arranged[i] = next(k)
+			k++
+		}
+		return types.NewStruct(arranged, nil)
+	}
+	best := fill(opt.Field)
+	reversed := fill(func(k int) *types.Var { return opt.Field(opt.NumFields() - 1 - k) })
+	if sizes.Sizeof(reversed) < sizes.Sizeof(best) {
+		return reversed
+	}
+	return best
+}
@@ -0,0 +1,294 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"go/types"
+)
+
+// maxExactStates bounds the memory used by the exact search.
+const maxExactStates = 1 << 20
+
+// layoutUnit is a run of fields which is placed as a whole, like a single field.
+type layoutUnit struct {
+	size  int64
+	align int64
+}
+
+// exactOrder returns an order of units giving the smallest struct, and the size of
+// that struct, aligned to structAlign. Pinned units keep their index, and the other
+// ones fill the remaining positions. Among equally small orders, the one closest
+// to the given order is returned. It returns false when there are more than
+// maxExactStates states to search, alignments do not divide structAlign, or
+// zero-size units are not pinned while others are.
+func exactOrder(units []layoutUnit, pinned []bool, structAlign int64) ([]int, int64, bool) {
+	return exactLayoutsOrder([][]layoutUnit{units}, pinned, []int64{structAlign})
+}
+
+// exactLayoutsOrder is exactOrder for units laid out in many layouts at once, like
+// the fields of the instantiations of a generic struct on every target, each
+// aligned to its own structAligns entry: it returns the order giving the smallest
+// total size of the structs. Units of the same sizes and alignments are
+// interchangeable, so the search runs over the number of remaining units of each
+// kind, and the current offsets modulo the struct alignments, which is all the
+// padding of the next units depends on, as the pinned units placed before the next
+// position only depend on the number of units placed so far.
+func exactLayoutsOrder(layouts [][]layoutUnit, pinned []bool, structAligns []int64) ([]int, int64, bool) {
+	n := len(layouts[0])
+	isPinned := func(i int) bool { return i < len(pinned) && pinned[i] }
+	hasPins := false
+	for i := 0; i < n; i++ {
+		hasPins = hasPins || isPinned(i)
+	}
+	// The offsets of all layouts are numbered in mixed radix.
+	offStates := 1
+	for l, units := range layouts {
+		for _, u := range units {
+			if u.align <= 0 || structAligns[l]%u.align != 0 {
+				return nil, 0, false
+			}
+		}
+		offStates *= int(structAligns[l])
+		if offStates > maxExactStates {
+			return nil, 0, false
+		}
+	}
+	sameUnits := func(i, j int) bool {
+		for _, units := range layouts {
+			if units[i] != units[j] {
+				return false
+			}
+		}
+		return true
+	}
+	zeroSize := func(i int) bool {
+		for _, units := range layouts {
+			if units[i].size != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Without pinned units, zero-size units go first: they need no padding there,
+	// while a zero-size last field is padded to avoid pointing past the struct.
+	var zeros []int
+	var slots []int // positions of the units which are not pinned
+	var members [][]int
+	for i := 0; i < n; i++ {
+		if isPinned(i) {
+			continue
+		}
+		if zeroSize(i) {
+			if hasPins {
+				return nil, 0, false
+			}
+			zeros = append(zeros, i)
+			continue
+		}
+		slots = append(slots, i)
+		k := 0
+		for k < len(members) && !sameUnits(members[k][0], i) {
+			k++
+		}
+		if k == len(members) {
+			members = append(members, nil)
+		}
+		members[k] = append(members[k], i)
+	}
+
+	// The remaining units are numbered in mixed radix, by kind.
+	radix := make([]int, len(members))
+	states := offStates
+	for k := range members {
+		radix[k] = states / offStates
+		states *= len(members[k]) + 1
+		if states > maxExactStates {
+			return nil, 0, false
+		}
+	}
+	remaining := make([]int, len(members))
+	full := 0
+	for k := range members {
+		remaining[k] = len(members[k])
+		full += remaining[k] * radix[k]
+	}
+
+	// place returns the bytes used by placing the units of indexes idx after the
+	// offsets numbered off, and the offsets after them.
+	place := func(off int, idx ...int) (used int64, next int) {
+		stride := 1
+		for l, units := range layouts {
+			sa := structAligns[l]
+			o0 := int64(off/stride) % sa
+			o := o0
+			for _, i := range idx {
+				o = align(o, units[i].align) + units[i].size
+			}
+			used += o - o0
+			next += int(o%sa) * stride
+			stride *= int(sa)
+		}
+		return used, next
+	}
+	// tail returns the padding at the end of the structs after the offsets
+	// numbered off.
+	tail := func(off int) (used int64) {
+		stride := 1
+		for l := range layouts {
+			sa := structAligns[l]
+			o := int64(off/stride) % sa
+			used += align(o, sa) - o
+			stride *= int(sa)
+		}
+		return used
+	}
+	// pins returns the indexes of the pinned units placed before the position of
+	// the next unit, once placed units are, or up to the end of the struct.
+	placed := 0
+	pins := func() []int {
+		if !hasPins {
+			return nil
+		}
+		from, to := 0, n
+		if placed > 0 {
+			from = slots[placed-1] + 1
+		}
+		if placed < len(slots) {
+			to = slots[placed]
+		}
+		idx := make([]int, 0, to-from)
+		for i := from; i < to; i++ {
+			idx = append(idx, i)
+		}
+		return idx
+	}
+
+	// memo holds the bytes needed after a state, plus one so that zero means
+	// unknown.
+	memo := make([]int64, states)
+	var best func(rem, off int) int64
+	best = func(rem, off int) int64 {
+		i := rem*offStates + off
+		if memo[i] > 0 {
+			return memo[i] - 1
+		}
+		pre, off := place(off, pins()...)
+		min := int64(-1)
+		if rem == 0 {
+			min = tail(off)
+		}
+		for k := range members {
+			if remaining[k] == 0 {
+				continue
+			}
+			used, o := place(off, members[k][0])
+			remaining[k]--
+			placed++
+			if n := used + best(rem-radix[k], o); min < 0 || n < min {
+				min = n
+			}
+			remaining[k]++
+			placed--
+		}
+		memo[i] = pre + min + 1
+		return pre + min
+	}
+	size := best(full, 0)
+
+	// Follow the decisions of the search, preferring earlier kinds.
+	var picks []int
+	rem, off := full, 0
+	for rem > 0 {
+		want := best(rem, off)
+		pre, after := place(off, pins()...)
+		for k := range members {
+			if remaining[k] == 0 {
+				continue
+			}
+			used, o := place(after, members[k][0])
+			remaining[k]--
+			placed++
+			if pre+used+best(rem-radix[k], o) == want {
+				picks = append(picks, members[k][len(members[k])-remaining[k]-1])
+				rem, off = rem-radix[k], o
+				break
+			}
+			remaining[k]++
+			placed--
+		}
+	}
+	if !hasPins {
+		return append(zeros, picks...), size, true
+	}
+	order := make([]int, n)
+	for i, k := 0, 0; i < n; i++ {
+		if isPinned(i) {
+			order[i] = i
+		} else {
+			order[i] = picks[k]
+			k++
+		}
+	}
+	return order, size, true
+}
+
+// exactStructArrangement returns the order of s fields giving the smallest struct
+// which keeps pinned fields at their position, ties broken by the order of s, and
+// reports whether the search completed. Structs with more than exactFields fields
+// which are not pinned are not searched.
+func exactStructArrangement(sizes types.Sizes, s *types.Struct, pinned []bool) (*types.Struct, bool) {
+	fields := structFields(s)
+	units := make([]layoutUnit, len(fields))
+	structAlign := int64(1)
+	n := 0
+	for i, f := range fields {
+		units[i] = layoutUnit{size: sizes.Sizeof(f.Type()), align: sizes.Alignof(f.Type())}
+		if units[i].align > structAlign {
+			structAlign = units[i].align
+		}
+		if units[i].size > 0 && (i >= len(pinned) || !pinned[i]) {
+			n++
+		}
+	}
+	if n > exactFields {
+		return nil, false
+	}
+	order, _, ok := exactOrder(units, pinned, structAlign)
+	if !ok {
+		return nil, false
+	}
+	optFields := make([]*types.Var, len(order))
+	for i, j := range order {
+		optFields[i] = fields[j]
+	}
+	return types.NewStruct(optFields, nil), true
+}
+
+// provenOptimal reports whether no order of s fields gives a struct smaller than
+// size on t. Sorted by decreasing alignment, after zero-size fields, fields need no
+// padding but at the end of the struct, as their sizes are multiples of their
+// alignment, so no struct is smaller than their total size, aligned.
+func provenOptimal(t target, s *types.Struct, size int64) bool {
+	var total int64
+	structAlign := int64(1)
+	for _, f := range structFields(s) {
+		total += t.sizes.Sizeof(f.Type())
+		if a := t.sizes.Alignof(f.Type()); a > structAlign {
+			structAlign = a
+		}
+	}
+	return size <= align(total, structAlign)
+}
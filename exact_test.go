@@ -0,0 +1,74 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExactOrder(t *testing.T) {
+	tests := []struct {
+		units       []layoutUnit
+		pinned      []bool
+		structAlign int64
+		wantOrder   []int
+		wantSize    int64
+	}{
+		{nil, nil, 1, nil, 0},
+		{[]layoutUnit{{4, 4}, {8, 8}, {4, 4}}, nil, 8, []int{0, 2, 1}, 16},
+		{[]layoutUnit{{8, 8}, {0, 8}}, nil, 8, []int{1, 0}, 8},
+		// Sorting by alignment leaves a hole after the odd sized run of fields.
+		{[]layoutUnit{{5, 4}, {4, 4}, {3, 1}}, nil, 4, []int{0, 2, 1}, 12},
+		{[]layoutUnit{{1, 1}, {2, 2}, {1, 1}}, nil, 2, []int{0, 2, 1}, 4},
+		// Neither the sorted nor the reversed order fit around the pinned unit.
+		{[]layoutUnit{{1, 1}, {1, 1}, {4, 4}, {2, 2}, {8, 8}}, []bool{false, false, false, true}, 8, []int{2, 0, 1, 3, 4}, 16},
+		// Zero-size units are not moved around pinned ones.
+		{[]layoutUnit{{8, 8}, {0, 1}, {1, 1}}, []bool{true}, 8, nil, 0},
+	}
+	for _, tt := range tests {
+		order, size, ok := exactOrder(tt.units, tt.pinned, tt.structAlign)
+		if ok != (tt.wantOrder != nil || tt.units == nil) {
+			t.Errorf("exactOrder(%v, %v) reports %t", tt.units, tt.pinned, ok)
+			continue
+		}
+		if size != tt.wantSize || !reflect.DeepEqual(order, tt.wantOrder) {
+			t.Errorf("exactOrder(%v, %v) = %v, %d, want %v, %d", tt.units, tt.pinned, order, size, tt.wantOrder, tt.wantSize)
+		}
+	}
+}
+
+func TestExactLayoutsOrder(t *testing.T) {
+	// The fields of struct{ a bool; x T; c int32 } for T int16 and int64: neither
+	// order optimal for one of them is the best for both.
+	layouts := [][]layoutUnit{
+		{{1, 1}, {2, 2}, {4, 4}},
+		{{1, 1}, {8, 8}, {4, 4}},
+	}
+	order, size, ok := exactLayoutsOrder(layouts, nil, []int64{4, 8})
+	if want := []int{1, 0, 2}; !ok || size != 24 || !reflect.DeepEqual(order, want) {
+		t.Errorf("exactLayoutsOrder(%v) = %v, %d, %t, want %v, 24, true", layouts, order, size, ok, want)
+	}
+}
+
+func TestExactOrderTooManyStates(t *testing.T) {
+	units := make([]layoutUnit, 32)
+	for i := range units {
+		units[i] = layoutUnit{size: int64(i + 1), align: 1}
+	}
+	if _, _, ok := exactOrder(units, nil, 1); ok {
+		t.Error("exactOrder succeeded, want too many states")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// layoutAnalyzer exports, as facts, what only the package declaring a named
+// struct type knows about its layout: its directives, mutex groups and atomic
+// fields, and whether its fields order is relied upon. The packages holding the
+// type compute from it how much smaller the type could be, when they need it.
+// Like orderAnalyzer, it runs on the dependencies of the analyzed packages too,
+// which is why it is separate from Analyzer.
+var layoutAnalyzer = &analysis.Analyzer{
+	Name:       "structslop_layout",
+	Doc:        "export the layout constraints of named struct types",
+	Requires:   []*analysis.Analyzer{orderAnalyzer},
+	Run:        runLayout,
+	ResultType: reflect.TypeOf(new(layoutFacts)),
+	FactTypes:  []analysis.Fact{new(layoutFact)},
+}
+
+// layoutFact is exported for the named struct types of a package whose layout is
+// constrained in their package. Fields are given by index.
+type layoutFact struct {
+	Ignored        bool   // declared with an ignore directive
+	OrderSensitive bool   // its fields order is relied upon in its package
+	Pinned         []bool `json:",omitempty"`
+	Atomic         []int  `json:",omitempty"` // 64-bit fields accessed atomically
+	Groups         []int  `json:",omitempty"`
+	Heads          []bool `json:",omitempty"`
+	Regroup        bool   `json:",omitempty"`
+}
+
+func (*layoutFact) AFact() {}
+
+func (f *layoutFact) String() string {
+	var attrs []string
+	if f.Ignored {
+		attrs = append(attrs, "ignored")
+	}
+	if f.OrderSensitive {
+		attrs = append(attrs, "order sensitive")
+	}
+	if len(f.Atomic) > 0 {
+		attrs = append(attrs, fmt.Sprintf("atomic %v", f.Atomic))
+	}
+	if f.Groups != nil {
+		attrs = append(attrs, fmt.Sprintf("groups %v", f.Groups))
+	}
+	return "layout(" + strings.Join(attrs, ", ") + ")"
+}
+
+// constraints returns the constraints on the fields order of styp, the struct
+// type of the fact.
+func (f *layoutFact) constraints(styp *types.Struct) constraints {
+	c := constraints{pinned: f.Pinned, groups: f.Groups, heads: f.Heads, regroup: f.Regroup}
+	for _, i := range f.Atomic {
+		if i < styp.NumFields() {
+			if c.atomic == nil {
+				c.atomic = make(map[*types.Var]bool)
+			}
+			c.atomic[styp.Field(i)] = true
+		}
+	}
+	return c
+}
+
+// layoutFacts holds the layout facts of the named struct types of a package and
+// of its dependencies.
+type layoutFacts struct {
+	m map[*types.TypeName]*layoutFact
+}
+
+// lookup returns the layout fact of T, if it is a named struct type.
+func (l *layoutFacts) lookup(T types.Type) *layoutFact {
+	named, ok := T.(*types.Named)
+	if !ok {
+		return nil
+	}
+	return l.m[named.Origin().Obj()]
+}
+
+func runLayout(pass *analysis.Pass) (interface{}, error) {
+	orderSensitive := pass.ResultOf[orderAnalyzer].(*orderSites)
+	ignored := ignoredTypes(pass.Files)
+	atomics := atomic64(atomicFields(pass))
+
+	res := &layoutFacts{m: make(map[*types.TypeName]*layoutFact)}
+	for atyp, spec := range typeSpecs(pass.Files) {
+		obj, ok := pass.TypesInfo.Defs[spec.Name].(*types.TypeName)
+		if !ok || obj.Parent() != pass.Pkg.Scope() {
+			continue
+		}
+		styp, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		c := structConstraints(pass.Fset, atyp, styp, atomics)
+		_, sites := splitOrderSites(styp, orderSensitive.lookup(obj.Type()))
+		f := &layoutFact{
+			Ignored:        isIgnored(ignored, atyp),
+			OrderSensitive: len(sites) > 0,
+			Groups:         c.groups,
+			Heads:          c.heads,
+			Regroup:        c.regroup,
+		}
+		if c.hasPins() {
+			f.Pinned = c.pinned
+		}
+		for i, v := range structFields(styp) {
+			if atomics[v] {
+				f.Atomic = append(f.Atomic, i)
+			}
+		}
+		if f.Ignored || f.OrderSensitive || f.Pinned != nil || f.Atomic != nil || f.Groups != nil {
+			pass.ExportObjectFact(obj, f)
+			res.m[obj] = f
+		}
+	}
+	for _, of := range pass.AllObjectFacts() {
+		if f, ok := of.Fact.(*layoutFact); ok {
+			if obj, ok := of.Object.(*types.TypeName); ok && obj.Pkg() != pass.Pkg {
+				res.m[obj] = f
+			}
+		}
+	}
+	return res, nil
+}
+
+// importedSloppyFields returns, for the fields of styp holding a sloppy named
+// struct type of another package, like embedded structs or arrays of them, a
+// description of how much smaller that type could be on target t.
+func importedSloppyFields(pass *analysis.Pass, facts *layoutFacts, t target, styp *types.Struct) (fields, notes []string) {
+	qf := qualifier(pass.Pkg.Path())
+	for i := 0; i < styp.NumFields(); i++ {
+		v := styp.Field(i)
+		T := v.Type()
+		for {
+			a, ok := T.Underlying().(*types.Array)
+			if !ok {
+				break
+			}
+			T = a.Elem()
+		}
+		named, ok := T.(*types.Named)
+		if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg() == pass.Pkg {
+			continue
+		}
+		nstyp, ok := named.Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		var c constraints
+		f := facts.lookup(named)
+		if f != nil {
+			if f.Ignored {
+				continue
+			}
+			c = f.constraints(nstyp)
+		}
+		r := checkSloppy(t, nstyp, c)
+		if !worthReporting([]result{r}, named.Obj().Pkg().Path()) {
+			continue
+		}
+		note := fmt.Sprintf("field %s holds %s, which has size %d (size class %d), could be %d (size class %d) if rearranged in its package",
+			v.Name(), types.TypeString(named, qf), r.oldGcSize, r.oldRuntimeSize, r.newGcSize, r.newRuntimeSize)
+		if f != nil && f.OrderSensitive {
+			note += ", but its fields order is relied upon there"
+		}
+		fields = append(fields, v.Name()+" "+types.TypeString(named, nil))
+		notes = append(notes, note)
+	}
+	return fields, notes
+}
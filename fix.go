@@ -0,0 +1,305 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"golang.org/x/tools/go/analysis"
+)
+
+// report is a diagnostic waiting for its suggested fix.
+type report struct {
+	name    string // qualified name of the struct
+	atyp    *ast.StructType
+	dtyp    *dst.StructType
+	changed bool                // whether the fields order was changed
+	keyed   []analysis.TextEdit // edits converting unkeyed literals of the struct to keyed form
+	diag    analysis.Diagnostic
+
+	heapSavings int64     // estimated from -heap-profile
+	nested      []*report // nested structs declared elsewhere, rearranged with this one
+}
+
+// reorderFields rearranges dtyp fields to the order given by idx. Fields declared
+// with many names, like "i1, i2 int", are moved as a whole, at the position of
+// their first name.
+func reorderFields(dtyp *dst.StructType, idx []int) {
+	fields := make([]*dst.Field, 0, len(idx))
+	dummy := &dst.Field{}
+	for _, f := range dtyp.Fields.List {
+		fields = append(fields, f)
+		if len(f.Names) == 0 {
+			continue
+		}
+		for range f.Names[1:] {
+			fields = append(fields, dummy)
+		}
+	}
+	optFields := make([]*dst.Field, 0, len(idx))
+	for _, i := range idx {
+		f := fields[i]
+		if f == dummy {
+			continue
+		}
+		optFields = append(optFields, f)
+	}
+	dtyp.Fields.List = optFields
+}
+
+// sameOrder reports whether idx keeps all fields in place.
+func sameOrder(idx []int) bool {
+	for i, j := range idx {
+		if i != j {
+			return false
+		}
+	}
+	return true
+}
+
+// suggestedFix returns the fix replacing the fields of rep struct with their new
+// order, along with the nested structs declared elsewhere rearranged with it, and
+// keying its unkeyed literals. The fix of a struct only rewrites that struct, and
+// the structs nested in it which are rearranged too, so that accepting the fix of
+// an inner struct never reorders the struct holding it.
+func suggestedFix(fset *token.FileSet, files []*ast.File, rep *report) (analysis.SuggestedFix, error) {
+	var edits []analysis.TextEdit
+	for _, r := range append([]*report{rep}, rep.nested...) {
+		edit, err := structEdit(fset, files, r)
+		if err != nil {
+			return analysis.SuggestedFix{}, err
+		}
+		edits = append(edits, edit)
+	}
+	return analysis.SuggestedFix{
+		Message:   "Rearrange struct fields",
+		TextEdits: append(edits, rep.keyed...),
+	}, nil
+}
+
+// structEdit returns the edit replacing the fields of rep struct with their new order.
+func structEdit(fset *token.FileSet, files []*ast.File, rep *report) (analysis.TextEdit, error) {
+	fields := rep.atyp.Fields
+	text, err := fieldListText(rep.dtyp, lineIndent(fset, files, rep.atyp.Struct))
+	if err != nil {
+		return analysis.TextEdit{}, err
+	}
+	// One-line structs, like struct{ a bool; b int }, are written on several
+	// lines, where gofmt puts a space before the opening brace.
+	if fields.Opening == rep.atyp.Struct+token.Pos(len("struct")) {
+		return analysis.TextEdit{Pos: fields.Opening, End: fields.Closing, NewText: append([]byte(" {"), text...)}, nil
+	}
+	return analysis.TextEdit{Pos: fields.Opening + 1, End: fields.Closing, NewText: text}, nil
+}
+
+// lineIndent returns the indentation of the line holding pos, from the column of
+// the first node starting on it, as gofmt indents lines with one tab per level.
+// It is computed from the syntax tree rather than the file on disk, which may
+// differ from the parsed source, like unsaved buffers in editors.
+func lineIndent(fset *token.FileSet, files []*ast.File, pos token.Pos) string {
+	tf := fset.File(pos)
+	line := tf.Line(pos)
+	col := tf.PositionFor(pos, false).Column
+	for _, f := range files {
+		if f.Pos() > pos || pos >= f.End() {
+			continue
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			if n == nil || tf.Line(n.Pos()) > line || tf.Line(n.End()) < line {
+				return false
+			}
+			if tf.Line(n.Pos()) == line {
+				if c := tf.PositionFor(n.Pos(), false).Column; c < col {
+					col = c
+				}
+			}
+			return true
+		})
+	}
+	return strings.Repeat("\t", col-1)
+}
+
+// keyedLiteralEdits returns the edits converting unkeyed composite literals of
+// styp to keyed form, which does not depend on the fields order, by prefixing
+// their elements with the name of their field.
+func keyedLiteralEdits(styp *types.Struct, lits []*ast.CompositeLit) []analysis.TextEdit {
+	var edits []analysis.TextEdit
+	for _, lit := range lits {
+		for i, elt := range lit.Elts {
+			if i >= styp.NumFields() {
+				break
+			}
+			edits = append(edits, analysis.TextEdit{
+				Pos:     elt.Pos(),
+				End:     elt.Pos(),
+				NewText: []byte(styp.Field(i).Name() + ": "),
+			})
+		}
+	}
+	return edits
+}
+
+// fieldListText returns the formatted source between the braces of dtyp, with
+// every line after the first one indented by indent.
+func fieldListText(dtyp *dst.StructType, indent string) ([]byte, error) {
+	styp := dst.Clone(dtyp).(*dst.StructType)
+	styp.Decs = dst.StructTypeDecorations{}
+	f := &dst.File{
+		Name: dst.NewIdent("p"),
+		Decls: []dst.Decl{&dst.GenDecl{
+			Tok:   token.TYPE,
+			Specs: []dst.Spec{&dst.TypeSpec{Name: dst.NewIdent("T"), Type: styp}},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := decorator.Fprint(&buf, f); err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	af, err := parser.ParseFile(fset, "", buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	fields := af.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields
+	tf := fset.File(fields.Pos())
+	text := buf.Bytes()[tf.Offset(fields.Opening)+1 : tf.Offset(fields.Closing)]
+	return bytes.ReplaceAll(text, []byte("\n"), []byte("\n"+indent)), nil
+}
+
+// rewrites holds the files rewritten by -apply: their source before the first
+// rewrite, and the edits applied to it so far. Test variants of a package analyze
+// its files again, with offsets into that source, so the edits of every variant
+// are deduplicated by byte range, and applied together to the original source.
+var rewrites struct {
+	mu    sync.Mutex
+	files map[string]*rewrite
+}
+
+type rewrite struct {
+	src   []byte
+	edits []offsetEdit
+	seen  map[offsetEdit]bool
+}
+
+// offsetEdit is a text edit with byte offsets into the source of its file.
+type offsetEdit struct {
+	start, end int
+	text       string
+}
+
+// writeFixes applies the suggested fixes of diags to the files on disk.
+func writeFixes(fset *token.FileSet, diags []analysis.Diagnostic) error {
+	rewrites.mu.Lock()
+	defer rewrites.mu.Unlock()
+	if rewrites.files == nil {
+		rewrites.files = make(map[string]*rewrite)
+	}
+	for f, edits := range fixEdits(fset, diags) {
+		st, err := os.Stat(f.Name())
+		if err != nil {
+			return fmt.Errorf("failed to get file stat: %w", err)
+		}
+		rw := rewrites.files[f.Name()]
+		if rw == nil {
+			src, err := readSource(f)
+			if err != nil {
+				return err
+			}
+			rw = &rewrite{src: src, seen: make(map[offsetEdit]bool)}
+			rewrites.files[f.Name()] = rw
+		}
+		for _, e := range offsetEdits(f, edits) {
+			if !rw.seen[e] {
+				rw.seen[e] = true
+				rw.edits = append(rw.edits, e)
+			}
+		}
+		if err := os.WriteFile(f.Name(), applyOffsetEdits(rw.src, rw.edits), st.Mode()); err != nil {
+			return fmt.Errorf("failed to write suggested fix to file: %w", err)
+		}
+	}
+	return nil
+}
+
+// readSource reads the source of f, which must not have changed since it was parsed.
+func readSource(f *token.File) ([]byte, error) {
+	src, err := os.ReadFile(f.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(src) != f.Size() {
+		return nil, fmt.Errorf("%s changed since it was parsed", f.Name())
+	}
+	return src, nil
+}
+
+// fixEdits returns the edits of the suggested fixes of diags, by file.
+func fixEdits(fset *token.FileSet, diags []analysis.Diagnostic) map[*token.File][]analysis.TextEdit {
+	fileEdits := make(map[*token.File][]analysis.TextEdit)
+	for _, d := range diags {
+		for _, fix := range d.SuggestedFixes {
+			for _, e := range fix.TextEdits {
+				f := fset.File(e.Pos)
+				fileEdits[f] = append(fileEdits[f], e)
+			}
+		}
+	}
+	return fileEdits
+}
+
+// applyEdits returns src with edits applied. Duplicate edits are applied once.
+func applyEdits(f *token.File, src []byte, edits []analysis.TextEdit) []byte {
+	return applyOffsetEdits(src, offsetEdits(f, edits))
+}
+
+// offsetEdits converts edits of f to byte offsets.
+func offsetEdits(f *token.File, edits []analysis.TextEdit) []offsetEdit {
+	oe := make([]offsetEdit, len(edits))
+	for i, e := range edits {
+		oe[i] = offsetEdit{start: f.Offset(e.Pos), end: f.Offset(e.End), text: string(e.NewText)}
+	}
+	return oe
+}
+
+// applyOffsetEdits returns src with edits applied. Duplicate edits are applied
+// once, and edits overlapping a previous one are dropped.
+func applyOffsetEdits(src []byte, edits []offsetEdit) []byte {
+	edits = append([]offsetEdit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var buf bytes.Buffer
+	last := 0
+	for i, e := range edits {
+		if i > 0 && e == edits[i-1] || e.start < last {
+			continue
+		}
+		buf.Write(src[last:e.start])
+		buf.WriteString(e.text)
+		last = e.end
+	}
+	buf.Write(src[last:])
+	return buf.Bytes()
+}
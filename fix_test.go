@@ -0,0 +1,54 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// TestNestedFixScope checks that the fix of a struct nested in another one only
+// rewrites the inner struct, while the fix of the outer struct includes it.
+func TestNestedFixScope(t *testing.T) {
+	results := analysistest.Run(t, analysistest.TestData(), Analyzer, "nestedfix")
+	want := map[string]string{
+		"nestedfix.outer.in": "type outer struct { // want `nestedfix.outer: struct has size 56`\n\ta  bool\n\tin struct { // want `nestedfix.outer.in: struct has size 24`\n\t\tx int64\n\t\ta bool\n\t\tb bool\n\t}",
+		"nestedfix.outer":    "type outer struct { // want `nestedfix.outer: struct has size 56`\n\tin struct { // want `nestedfix.outer.in: struct has size 24`\n\t\tx int64\n\t\ta bool\n\t\tb bool\n\t}\n\tx int64\n\ta bool\n\tb bool\n\tc bool\n}",
+	}
+	for _, r := range results {
+		for _, d := range r.Diagnostics {
+			name, _, _ := strings.Cut(d.Message, ":")
+			if len(d.SuggestedFixes) != 1 {
+				t.Fatalf("%s: got %d suggested fixes, want 1", name, len(d.SuggestedFixes))
+			}
+			f := r.Pass.Fset.File(d.Pos)
+			src, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(applyEdits(f, src, d.SuggestedFixes[0].TextEdits))
+			if !strings.Contains(got, want[name]) {
+				t.Errorf("%s: fix gives:\n%s\nwant it to contain:\n%s", name, got, want[name])
+			}
+			delete(want, name)
+		}
+	}
+	for name := range want {
+		t.Errorf("%s: not reported", name)
+	}
+}
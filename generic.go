@@ -0,0 +1,302 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// genericAnalyzer finds the instantiations of generic struct types, whose layout
+// depends on their type arguments, and the fields order which is best across the
+// instantiations of every package. It exports that order as a fact, so that the
+// instantiations in importers are checked against it.
+var genericAnalyzer = &analysis.Analyzer{
+	Name:       "structslop_generic",
+	Doc:        "find the instantiations of generic struct types and their best fields order",
+	Run:        runGeneric,
+	ResultType: reflect.TypeOf(new(genericInstances)),
+	FactTypes:  []analysis.Fact{new(genericOrderFact)},
+}
+
+// genericOrderFact is exported for generic struct types instantiated in their
+// package, with the fields order suggested for these instantiations.
+type genericOrderFact struct {
+	Order []int
+}
+
+func (*genericOrderFact) AFact() {}
+
+func (f *genericOrderFact) String() string {
+	return fmt.Sprintf("genericOrder(%v)", f.Order)
+}
+
+// genericInstance is a concrete instantiation of a generic struct type.
+type genericInstance struct {
+	id   *ast.Ident // of its first use in the package
+	typ  *types.Named
+	styp *types.Struct
+}
+
+// genericPlan is the fields order of a generic struct type, for its instantiations.
+type genericPlan struct {
+	instances []genericInstance
+	order     []int
+	suggested bool // order is the one suggested for the instantiations of its package
+}
+
+// genericInstances holds the instantiations of generic struct types of a package.
+type genericInstances struct {
+	local   map[*types.TypeName]*genericPlan // generic types of the package, by origin
+	foreign []*genericPlan                   // instantiations of generic types of other packages
+}
+
+func runGeneric(pass *analysis.Pass) (interface{}, error) {
+	classes, err := sizeClassesFor(goVersion)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := parseTargets(compiler, goarch, classes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the concrete instantiations of generic struct types, in order of
+	// appearance.
+	var idents []*ast.Ident
+	for id := range pass.TypesInfo.Instances {
+		idents = append(idents, id)
+	}
+	sort.Slice(idents, func(i, j int) bool { return idents[i].Pos() < idents[j].Pos() })
+	res := &genericInstances{local: make(map[*types.TypeName]*genericPlan)}
+	foreign := make(map[*types.TypeName]*genericPlan)
+	for _, id := range idents {
+		if strings.HasSuffix(pass.Fset.File(id.Pos()).Name(), "_test.go") && !includeTestFiles {
+			continue
+		}
+		named, ok := pass.TypesInfo.Instances[id].Type.(*types.Named)
+		if !ok || !layoutDependsOnTypeParams(named.Origin().Underlying()) {
+			continue
+		}
+		styp, ok := named.Underlying().(*types.Struct)
+		if !ok || layoutDependsOnTypeParams(styp) {
+			continue
+		}
+		obj := named.Origin().Obj()
+		plans := res.local
+		if obj.Pkg() != pass.Pkg {
+			plans = foreign
+		}
+		p := plans[obj]
+		if p == nil {
+			p = new(genericPlan)
+			plans[obj] = p
+		}
+		known := false
+		for _, inst := range p.instances {
+			known = known || types.Identical(inst.typ, named)
+		}
+		if !known {
+			p.instances = append(p.instances, genericInstance{id: id, typ: named, styp: styp})
+		}
+	}
+
+	// Find the best order of the generic types of the package, and export it.
+	atomics := atomic64(atomicFields(pass))
+	for atyp, spec := range typeSpecs(pass.Files) {
+		obj, ok := pass.TypesInfo.Defs[spec.Name].(*types.TypeName)
+		if !ok || res.local[obj] == nil {
+			continue
+		}
+		p := res.local[obj]
+		gstyp := obj.Type().Underlying().(*types.Struct)
+		p.order = instancesOrder(targets, p.instances, structConstraints(pass.Fset, atyp, gstyp, atomics))
+		p.suggested = true
+		pass.ExportObjectFact(obj, &genericOrderFact{Order: p.order})
+	}
+	for obj, p := range foreign {
+		var f genericOrderFact
+		if pass.ImportObjectFact(obj, &f) && len(f.Order) == p.instances[0].styp.NumFields() {
+			p.order, p.suggested = f.Order, true
+		} else {
+			p.order = make([]int, p.instances[0].styp.NumFields())
+			for i := range p.order {
+				p.order[i] = i
+			}
+		}
+		res.foreign = append(res.foreign, p)
+	}
+	sort.Slice(res.foreign, func(i, j int) bool {
+		return res.foreign[i].instances[0].id.Pos() < res.foreign[j].instances[0].id.Pos()
+	})
+	return res, nil
+}
+
+// instancesOrder returns the fields order which is best across all instantiations
+// of a generic struct type and all targets, like bestOrder does for targets. The
+// candidates are the declared order, the optimal order of every instantiation, and
+// the order giving the smallest total size of all of them, unless fields are
+// grouped.
+func instancesOrder(targets []target, instances []genericInstance, c constraints) []int {
+	identity := make([]int, instances[0].styp.NumFields())
+	for i := range identity {
+		identity[i] = i
+	}
+	candidates := [][]int{identity}
+	var layouts [][]layoutUnit
+	var structAligns []int64
+	for _, inst := range instances {
+		for _, t := range targets {
+			candidates = append(candidates, checkSloppy(t, inst.styp, c).optIdx)
+			units := make([]layoutUnit, len(identity))
+			for i, f := range structFields(inst.styp) {
+				units[i] = layoutUnit{size: t.sizes.Sizeof(f.Type()), align: t.sizes.Alignof(f.Type())}
+			}
+			layouts = append(layouts, units)
+			structAligns = append(structAligns, t.sizes.Alignof(inst.styp))
+		}
+	}
+	if c.groups == nil {
+		if idx, _, ok := exactLayoutsOrder(layouts, c.pinned, structAligns); ok {
+			candidates = append(candidates, idx)
+		}
+	}
+	var best []int
+	var bestRuntimeSize, bestGcSize, bestPtrdata int64
+	for i, idx := range candidates {
+		var runtimeSize, gcSize, scanned int64
+		for _, inst := range instances {
+			for _, t := range targets {
+				r := arrange(t, inst.styp, idx)
+				runtimeSize += r.newRuntimeSize
+				gcSize += r.newGcSize
+				scanned += r.newPtrdata
+			}
+		}
+		better := runtimeSize < bestRuntimeSize ||
+			runtimeSize == bestRuntimeSize && (gcSize < bestGcSize || gcSize == bestGcSize && scanned < bestPtrdata)
+		if i == 0 || better {
+			best, bestRuntimeSize, bestGcSize, bestPtrdata = idx, runtimeSize, gcSize, scanned
+		}
+	}
+	return best
+}
+
+// lookup returns the plan of the generic struct type declared by spec, if it is
+// instantiated in the package.
+func (g *genericInstances) lookup(pass *analysis.Pass, spec *ast.TypeSpec) *genericPlan {
+	if spec == nil || spec.TypeParams == nil {
+		return nil
+	}
+	obj, ok := pass.TypesInfo.Defs[spec.Name].(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	return g.local[obj]
+}
+
+// results returns the targets, one per instantiation and target, and the results of
+// the fields order of p for each of them. It also describes the instantiations
+// whose own optimal order would give a smaller size class.
+func (p *genericPlan) results(targets []target, c constraints, qf types.Qualifier) ([]target, []result, []string) {
+	var its []target
+	var results []result
+	var disagree []string
+	for _, inst := range p.instances {
+		name := types.TypeString(inst.typ, qf)
+		for _, t := range targets {
+			t.instance, t.label = name, name
+			if len(targets) > 1 {
+				t.label = fmt.Sprintf("%s on %s", name, t.goarch)
+			}
+			r := arrange(t, inst.styp, p.order)
+			r.proven = provenOptimal(t, inst.styp, r.newGcSize)
+			if opt := checkSloppy(t, inst.styp, c); opt.newRuntimeSize < r.newRuntimeSize {
+				disagree = append(disagree, fmt.Sprintf("%s could be %d (size class %d)", t.label, opt.newGcSize, opt.newRuntimeSize))
+			}
+			its = append(its, t)
+			results = append(results, r)
+		}
+	}
+	return its, results, disagree
+}
+
+// reportForeignInstances reports the instantiations of generic struct types of
+// other packages which would be smaller with another fields order than the one
+// suggested for the instantiations of their package, or their declared order.
+// Constraints from the declaration, like pinned fields, are not known here.
+func reportForeignInstances(pass *analysis.Pass, targets []target, g *genericInstances, skipped func(ast.Node) bool) {
+	qf := qualifier(pass.Pkg.Path())
+	for _, p := range g.foreign {
+		order := "declared fields order"
+		if p.suggested {
+			order = "fields order suggested for its package"
+		}
+		for _, inst := range p.instances {
+			if skipped(inst.id) {
+				continue
+			}
+			for _, t := range targets {
+				cur := arrange(t, inst.styp, p.order)
+				r := arrange(t, inst.styp, checkSloppy(t, inst.styp, constraints{}).optIdx)
+				r.oldGcSize, r.oldRuntimeSize, r.oldPtrdata = cur.newGcSize, cur.newRuntimeSize, cur.newPtrdata
+				if !worthReporting([]result{r}, pass.Pkg.Path()) {
+					continue
+				}
+				name := types.TypeString(inst.typ, qf)
+				if len(targets) > 1 {
+					name = fmt.Sprintf("%s on %s", name, t.goarch)
+				}
+				pass.Report(analysis.Diagnostic{
+					Pos:      inst.id.Pos(),
+					Category: categorySize,
+					Message: fmt.Sprintf(
+						"instantiation %s has size %d (size class %d) with the %s, could be %d (size class %d) with another order",
+						name, r.oldGcSize, r.oldRuntimeSize, order, r.newGcSize, r.newRuntimeSize,
+					),
+				})
+				break
+			}
+		}
+	}
+}
+
+// layoutDependsOnTypeParams reports whether the size or alignment of T depends on
+// type parameters.
+func layoutDependsOnTypeParams(T types.Type) bool {
+	switch t := T.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Array:
+		return layoutDependsOnTypeParams(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if layoutDependsOnTypeParams(t.Field(i).Type()) {
+				return true
+			}
+		}
+	case *types.Named:
+		if t.TypeArgs().Len() > 0 {
+			return layoutDependsOnTypeParams(t.Underlying())
+		}
+	}
+	return false
+}
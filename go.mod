@@ -4,6 +4,7 @@ go 1.20
 
 require (
 	github.com/dave/dst v0.27.2
+	github.com/google/pprof v0.0.0-20240409012703-83162a5b38cd
 	golang.org/x/tools v0.8.0
 )
 
@@ -0,0 +1,236 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/dave/dst"
+)
+
+// fieldGroups returns, for every field of atyp, the index of its group. Groups are
+// runs of fields separated by blank lines, or started by a field with a doc comment,
+// like "// protected by mu".
+func fieldGroups(fset *token.FileSet, atyp *ast.StructType) []int {
+	var groups []int
+	g := 0
+	for i, f := range atyp.Fields.List {
+		if i > 0 {
+			prev := atyp.Fields.List[i-1]
+			prevEnd := prev.End()
+			if prev.Comment != nil {
+				prevEnd = prev.Comment.End()
+			}
+			start := f.Pos()
+			if f.Doc != nil {
+				start = f.Doc.Pos()
+			}
+			if f.Doc != nil || fset.Position(start).Line > fset.Position(prevEnd).Line+1 {
+				g++
+			}
+		}
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// groupedStructArrangement returns the best arrangement found which keeps the
+// groups of fields together, rearranging fields within every group. Groups are
+// numbered in order of appearance, and keep their order unless reorder is set.
+// Fields of a group are sorted like optimalStructArrangement does, or in the
+// reverse order when it packs better with the previous group, after the field
+// heading the group, if any.
+func groupedStructArrangement(sizes types.Sizes, s *types.Struct, groups []int, heads []bool, reorder bool) *types.Struct {
+	fields := structFields(s)
+	var members [][]*types.Var
+	var groupHeads []*types.Var
+	for i, f := range fields {
+		g := groups[i]
+		if g == len(members) {
+			members = append(members, nil)
+			groupHeads = append(groupHeads, nil)
+		}
+		if heads != nil && heads[i] {
+			groupHeads[g] = f
+			continue
+		}
+		members[g] = append(members[g], f)
+	}
+	// Arrangements of every group: sorted by decreasing alignment, and reversed,
+	// zero-size fields first.
+	arrangements := make([][2][]*types.Var, len(members))
+	units := make([]layoutUnit, len(members))
+	structAlign := int64(1)
+	for g, m := range members {
+		idx := make(map[*types.Var]int, len(m))
+		for i, f := range m {
+			idx[f] = i
+		}
+		desc := structFields(optimalStructArrangement(sizes, idx))
+		zero := 0
+		for zero < len(desc) && sizes.Sizeof(desc[zero].Type()) == 0 {
+			zero++
+		}
+		asc := append([]*types.Var(nil), desc[:zero]...)
+		for i := len(desc) - 1; i >= zero; i-- {
+			asc = append(asc, desc[i])
+		}
+		if h := groupHeads[g]; h != nil {
+			desc = append([]*types.Var{h}, desc...)
+			asc = append([]*types.Var{h}, asc...)
+			m = append(m, h)
+		}
+		arrangements[g] = [2][]*types.Var{desc, asc}
+		for _, f := range m {
+			units[g].size += sizes.Sizeof(f.Type())
+			if a := sizes.Alignof(f.Type()); a > units[g].align {
+				units[g].align = a
+			}
+		}
+		if units[g].align > structAlign {
+			structAlign = units[g].align
+		}
+	}
+
+	order := make([]int, len(members))
+	for g := range order {
+		order[g] = g
+	}
+	if reorder {
+		if o, _, ok := exactOrder(units, nil, structAlign); ok {
+			order = o
+		}
+	}
+
+	// Choose the arrangement of every group, in order, minimizing the bytes used
+	// for every offset modulo the struct alignment.
+	type state struct {
+		used   int64
+		choice []int // arrangement of every group so far
+	}
+	states := map[int64]state{0: {}}
+	for _, g := range order {
+		next := make(map[int64]state)
+		for off, st := range states {
+			for a, arr := range arrangements[g] {
+				o, used := off, st.used
+				for _, f := range arr {
+					end := align(o, sizes.Alignof(f.Type())) + sizes.Sizeof(f.Type())
+					used += end - o
+					o = end
+				}
+				o %= structAlign
+				if cur, ok := next[o]; !ok || used < cur.used {
+					next[o] = state{used, append(append([]int(nil), st.choice...), a)}
+				}
+			}
+		}
+		states = next
+	}
+	var best state
+	first := true
+	for off, st := range states {
+		st.used += align(off, structAlign) - off
+		if first || st.used < best.used || st.used == best.used && lessChoice(st.choice, best.choice) {
+			best, first = st, false
+		}
+	}
+	var optFields []*types.Var
+	for i, g := range order {
+		optFields = append(optFields, arrangements[g][best.choice[i]]...)
+	}
+	return types.NewStruct(optFields, nil)
+}
+
+// lessChoice orders equally good choices of group arrangements, preferring sorted
+// groups, so that results do not depend on map iteration order.
+func lessChoice(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// keepsGroups reports whether the order given by idx keeps the fields of every
+// group together, with their head first, and, unless reorder is set, the groups
+// in their order.
+func keepsGroups(idx []int, groups []int, heads []bool, reorder bool) bool {
+	done := make(map[int]bool)
+	for i, j := range idx {
+		g := groups[j]
+		first := i == 0 || groups[idx[i-1]] != g
+		if i > 0 && first {
+			if done[g] || !reorder && g < groups[idx[i-1]] {
+				return false
+			}
+			done[groups[idx[i-1]]] = true
+		}
+		if heads != nil && heads[j] && !first {
+			return false
+		}
+	}
+	return true
+}
+
+// moveGroupHeaders moves the comments and blank line starting every group of the
+// fields of dtyp, which reorderFields moved with the first field of the group, to
+// the field now first in the group, when headers is set. Groups are then separated
+// by a blank line. orig is the list of fields before reorderFields, decls and
+// groups the declaration and group of every field.
+func moveGroupHeaders(dtyp *dst.StructType, orig []*dst.Field, decls, groups []int, headers bool) {
+	declGroups := make([]int, len(orig))
+	for i, d := range decls {
+		declGroups[d] = groups[i]
+	}
+	group := make(map[*dst.Field]int, len(orig))
+	origFirst := make(map[int]*dst.Field)
+	for i, f := range orig {
+		group[f] = declGroups[i]
+		if _, ok := origFirst[declGroups[i]]; !ok {
+			origFirst[declGroups[i]] = f
+		}
+	}
+	seen := make(map[int]bool)
+	for i, f := range dtyp.Fields.List {
+		g := group[f]
+		// Blank lines are only kept between groups, whatever their order.
+		f.Decs.After = dst.None
+		if seen[g] {
+			f.Decs.Before = dst.NewLine
+			continue
+		}
+		seen[g] = true
+		if o := origFirst[g]; headers && o != f {
+			o.Decs.Before, f.Decs.Before = f.Decs.Before, o.Decs.Before
+			o.Decs.Start, f.Decs.Start = f.Decs.Start, o.Decs.Start
+		}
+		switch {
+		case i == 0:
+			f.Decs.Before = dst.NewLine
+		case len(f.Decs.Start) == 0:
+			f.Decs.Before = dst.EmptyLine
+		}
+	}
+}
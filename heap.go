@@ -0,0 +1,231 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/pprof/profile"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// heapSite is an allocation site of a heap profile, with the number of objects
+// and bytes allocated there.
+type heapSite struct {
+	file    string
+	line    int64
+	objects int64
+	bytes   int64
+}
+
+// heapProfile holds the allocation sites of the -heap-profile file, loaded once.
+type heapProfile struct {
+	mu    sync.Mutex
+	path  string
+	sites map[string][]heapSite // by site key
+	err   error
+}
+
+var allocProfile heapProfile
+
+// checkHeapProfile validates the -heap-profile and -min-heap-savings flags, and
+// loads the profile.
+func checkHeapProfile() error {
+	if heapProfilePath == "" {
+		return nil
+	}
+	if minHeapSavings < 0 {
+		return fmt.Errorf("invalid minimum heap savings: %d", minHeapSavings)
+	}
+	return allocProfile.load()
+}
+
+// load reads the -heap-profile file, if it changed since the last call.
+func (h *heapProfile) load() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.path == heapProfilePath && (h.sites != nil || h.err != nil) {
+		return h.err
+	}
+	h.path, h.sites, h.err = heapProfilePath, nil, nil
+	sites, err := readHeapProfile(heapProfilePath)
+	if err != nil {
+		h.err = fmt.Errorf("invalid heap profile %s: %w", heapProfilePath, err)
+		return h.err
+	}
+	h.sites = make(map[string][]heapSite)
+	for _, s := range sites {
+		k := siteKey(s.file, s.line)
+		h.sites[k] = append(h.sites[k], s)
+	}
+	return nil
+}
+
+// lookup returns the allocation sites of the source line with the given siteKey.
+func (h *heapProfile) lookup(key string) []heapSite {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sites[key]
+}
+
+// siteKey identifies a source line by the last directory and the name of its file,
+// as the profiled binary may have been built from another copy of the sources.
+func siteKey(file string, line int64) string {
+	dir, base := filepath.Split(filepath.Clean(file))
+	return fmt.Sprintf("%s/%s:%d", filepath.Base(dir), base, line)
+}
+
+// allocations are the numbers of objects and slice elements of a struct type
+// allocated on the heap.
+type allocations struct {
+	objects  int64
+	elements int64
+}
+
+// savedBytes estimates the bytes which the allocations would save with r.
+func (a allocations) savedBytes(r result) int64 {
+	return a.objects*(r.oldRuntimeSize-r.newRuntimeSize) + a.elements*(r.oldGcSize-r.newGcSize)
+}
+
+// heapAllocations attributes the allocation sites of the heap profile to the struct
+// types allocated there by the package: new(T), &T{} and make([]T, n). Sites
+// allocating many structs share their objects between them.
+func heapAllocations(pass *analysis.Pass) *typeutil.Map {
+	type alloc struct {
+		T    types.Type
+		size int64 // of slice elements, zero for single objects
+	}
+	byLine := make(map[string][]alloc)
+	add := func(n ast.Node, T types.Type, slice bool) {
+		if T == nil {
+			return
+		}
+		a := alloc{T: orderKey(T)}
+		if a.T == nil {
+			return
+		}
+		if slice {
+			if a.size = pass.TypesSizes.Sizeof(T); a.size == 0 {
+				return
+			}
+		}
+		pos := pass.Fset.Position(n.Pos())
+		k := siteKey(pos.Filename, int64(pos.Line))
+		byLine[k] = append(byLine[k], a)
+	}
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.UnaryExpr:
+				if _, ok := astutil.Unparen(n.X).(*ast.CompositeLit); ok && n.Op == token.AND {
+					add(n, pass.TypesInfo.TypeOf(n.X), false)
+				}
+			case *ast.CallExpr:
+				b, ok := typeutil.Callee(pass.TypesInfo, n).(*types.Builtin)
+				if !ok || len(n.Args) == 0 {
+					return true
+				}
+				switch b.Name() {
+				case "new":
+					add(n, pass.TypesInfo.TypeOf(n.Args[0]), false)
+				case "make":
+					if s, ok := pass.TypesInfo.TypeOf(n.Args[0]).Underlying().(*types.Slice); ok {
+						add(n, s.Elem(), true)
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	counts := new(typeutil.Map)
+	for k, allocs := range byLine {
+		for _, s := range allocProfile.lookup(k) {
+			n := int64(len(allocs))
+			for _, a := range allocs {
+				c, _ := counts.At(a.T).(allocations)
+				if a.size > 0 {
+					c.elements += s.bytes / a.size / n
+				} else {
+					c.objects += s.objects / n
+				}
+				counts.Set(a.T, c)
+			}
+		}
+	}
+	return counts
+}
+
+// readHeapProfile returns the allocation sites of a pprof heap profile, that is,
+// the first frame outside of the runtime of every sample, with its allocated
+// objects and bytes.
+func readHeapProfile(path string) ([]heapSite, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	objects, space := valueIndex(p, "alloc_objects", "inuse_objects"), valueIndex(p, "alloc_space", "inuse_space")
+	if objects < 0 || space < 0 {
+		return nil, errors.New("not a heap profile")
+	}
+
+	var sites []heapSite
+	for _, s := range p.Sample {
+	frames:
+		for _, loc := range s.Location {
+			for _, l := range loc.Line {
+				if l.Function == nil || strings.HasPrefix(l.Function.Name, "runtime.") {
+					continue
+				}
+				sites = append(sites, heapSite{
+					file:    l.Function.Filename,
+					line:    l.Line,
+					objects: s.Value[objects],
+					bytes:   s.Value[space],
+				})
+				break frames
+			}
+		}
+	}
+	return sites, nil
+}
+
+// valueIndex returns the index of the first sample value of p of the given types,
+// or -1.
+func valueIndex(p *profile.Profile, types ...string) int {
+	for _, typ := range types {
+		for i, st := range p.SampleType {
+			if st.Type == typ {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+	"text/tabwriter"
+)
+
+// layoutSymbols are the symbols of fields in byte maps, in fields order.
+const layoutSymbols = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// fieldLayout is the position of a field in a struct.
+type fieldLayout struct {
+	name    string
+	typ     string
+	offset  int64
+	size    int64
+	align   int64
+	padding int64 // padding bytes after the field
+}
+
+// structLayout returns the layout of the fields of s.
+func structLayout(sizes types.Sizes, s *types.Struct, qualifier types.Qualifier) []fieldLayout {
+	fields := structFields(s)
+	offsets := sizes.Offsetsof(fields)
+	structSize := sizes.Sizeof(s)
+	layout := make([]fieldLayout, len(fields))
+	for i, f := range fields {
+		layout[i] = fieldLayout{
+			name:   f.Name(),
+			typ:    types.TypeString(f.Type(), qualifier),
+			offset: offsets[i],
+			size:   sizes.Sizeof(f.Type()),
+			align:  sizes.Alignof(f.Type()),
+		}
+	}
+	for i := range layout {
+		end := structSize
+		if i+1 < len(layout) {
+			end = layout[i+1].offset
+		}
+		layout[i].padding = end - layout[i].offset - layout[i].size
+	}
+	return layout
+}
+
+// layoutMessage returns the current layout of s and, when it changes, its optimal
+// layout.
+func layoutMessage(sizes types.Sizes, s *types.Struct, r result, qualifier types.Qualifier) string {
+	wordSize := sizes.Sizeof(types.Typ[types.UnsafePointer])
+	msg := formatLayout("current layout", structLayout(sizes, s, qualifier), sizes.Sizeof(s), wordSize)
+	if r.changed() {
+		msg += formatLayout("optimal layout", structLayout(sizes, r.optStruct, qualifier), sizes.Sizeof(r.optStruct), wordSize)
+	}
+	return msg
+}
+
+// formatLayout returns a table of the fields layout, followed by a byte map of the
+// struct with one row per word, where each byte shows the symbol of its field, or a
+// dot for padding. Identical consecutive rows are only printed once. Rows are
+// computed from the fields offsets as they are printed, and rows inside the same
+// field or padding are skipped at once, so that large fields like [1<<30]byte cost
+// nothing.
+func formatLayout(title string, layout []fieldLayout, structSize, wordSize int64) string {
+	var b strings.Builder
+	b.WriteString(title + ":\n")
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tfield\ttype\toffset\tsize\talign\tpadding")
+	for i, f := range layout {
+		fmt.Fprintf(tw, "%c\t%s\t%s\t%d\t%d\t%d\t%d\n", layoutSymbol(i), f.name, f.typ, f.offset, f.size, f.align, f.padding)
+	}
+	_ = tw.Flush()
+
+	width := len(fmt.Sprint(structSize))
+	var prev string
+	var repeat int64
+	flush := func() {
+		if repeat > 0 {
+			fmt.Fprintf(&b, "%*s  (%d more)\n", width, "", repeat)
+			repeat = 0
+		}
+	}
+	k := 0 // first field ending after the current row starts
+	for off := int64(0); off < structSize; off += wordSize {
+		for k < len(layout) && layout[k].offset+layout[k].size <= off {
+			k++
+		}
+		end := off + wordSize
+		if end > structSize {
+			end = structSize
+		}
+		row := layoutRow(layout, k, off, end)
+		if row == prev && strings.Count(row, row[:1]) == len(row) {
+			repeat++
+			// The following full rows up to the end of the field or padding holding
+			// this row are identical.
+			regionEnd := structSize
+			if k < len(layout) {
+				regionEnd = layout[k].offset
+				if regionEnd <= off {
+					regionEnd += layout[k].size
+				}
+			}
+			if n := (regionEnd-off)/wordSize - 1; n > 0 {
+				repeat += n
+				off += n * wordSize
+			}
+			continue
+		}
+		flush()
+		fmt.Fprintf(&b, "%*d  %s\n", width, off, row)
+		prev = row
+	}
+	flush()
+	return b.String()
+}
+
+// layoutRow returns the byte map of the struct from off to end, where k is the
+// first field ending after off.
+func layoutRow(layout []fieldLayout, k int, off, end int64) string {
+	row := make([]byte, end-off)
+	for i := range row {
+		row[i] = '.'
+	}
+	for j := k; j < len(layout) && layout[j].offset < end; j++ {
+		from, to := layout[j].offset, layout[j].offset+layout[j].size
+		if from < off {
+			from = off
+		}
+		if to > end {
+			to = end
+		}
+		for i := from; i < to; i++ {
+			row[i-off] = layoutSymbol(j)
+		}
+	}
+	return string(row)
+}
+
+// layoutSymbol returns the symbol of the i-th field in byte maps.
+func layoutSymbol(i int) byte {
+	if i < len(layoutSymbols) {
+		return layoutSymbols[i]
+	}
+	return '#'
+}
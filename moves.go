@@ -0,0 +1,260 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// maxMoveSubsets bounds the number of sets of moved declarations tried by
+// minimalMoves.
+const maxMoveSubsets = 1 << 12
+
+// fieldDecls returns, for every field of atyp, the index of the declaration of the
+// field. Fields declared with many names, like "i1, i2 int", share a declaration.
+func fieldDecls(atyp *ast.StructType) []int {
+	var decls []int
+	for i, f := range atyp.Fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			decls = append(decls, i)
+		}
+	}
+	return decls
+}
+
+// minimalMoves returns the order of styp fields which moves the fewest field
+// declarations, while reaching the size classes and ptrdata of results on every
+// target. Declarations are moved as a whole, as the suggested fix does. It returns
+// false when no such order is found within the search bounds.
+func minimalMoves(targets []target, styp *types.Struct, c constraints, results []result) ([]int, bool) {
+	fields := structFields(styp)
+	if len(fields) > exactFields || len(c.decls) != len(fields) {
+		return nil, false
+	}
+	sizes := targets[0].sizes
+
+	// Group fields by declaration.
+	var units []layoutUnit
+	var unitFields [][]int
+	var movable []bool
+	structAlign := int64(1)
+	for i, f := range fields {
+		if i == 0 || c.decls[i] != c.decls[i-1] {
+			units = append(units, layoutUnit{align: sizes.Alignof(f.Type())})
+			unitFields = append(unitFields, nil)
+			movable = append(movable, true)
+		}
+		u := len(units) - 1
+		units[u].size += sizes.Sizeof(f.Type())
+		unitFields[u] = append(unitFields[u], i)
+		if c.hasPins() && c.pinned[i] {
+			movable[u] = false
+		}
+		if units[u].align > structAlign {
+			structAlign = units[u].align
+		}
+	}
+
+	fits := func(order []int) ([]int, bool) {
+		var idx []int
+		for _, u := range order {
+			idx = append(idx, unitFields[u]...)
+		}
+		for i, t := range targets {
+			r := arrange(t, styp, idx)
+			if r.newRuntimeSize > results[i].newRuntimeSize || r.newPtrdata > results[i].newPtrdata {
+				return nil, false
+			}
+		}
+		for i, j := range idx {
+			if c.hasPins() && c.pinned[j] && i != j {
+				return nil, false
+			}
+		}
+		if c.groups != nil && !keepsGroups(idx, c.groups, c.heads, c.regroup) {
+			return nil, false
+		}
+		arranged := make([]*types.Var, len(idx))
+		for i, j := range idx {
+			arranged[i] = fields[j]
+		}
+		if misaligned, _ := misalignedAtomics(arranged, c.atomic); len(misaligned) > 0 {
+			return nil, false
+		}
+		return idx, true
+	}
+
+	tried := 0
+	var subset []int
+	var found []int
+	// choose adds k more movable units after unit from to subset, and tries the
+	// resulting set of moved units.
+	var choose func(from, k int) bool
+	choose = func(from, k int) bool {
+		if k == 0 {
+			tried++
+			order, ok := placeMoved(units, subset, structAlign)
+			if !ok {
+				return false
+			}
+			idx, ok := fits(order)
+			if ok {
+				found = idx
+			}
+			return ok
+		}
+		for u := from; u < len(units) && tried < maxMoveSubsets; u++ {
+			if !movable[u] {
+				continue
+			}
+			subset = append(subset, u)
+			if choose(u+1, k-1) {
+				return true
+			}
+			subset = subset[:len(subset)-1]
+		}
+		return false
+	}
+	for k := 1; k <= len(units) && tried < maxMoveSubsets; k++ {
+		if choose(0, k) {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+// placeMoved returns the order of units giving the smallest struct, where the
+// units not in moved keep their relative order, and the moved ones are inserted
+// anywhere. The search runs over the number of kept units placed, the set of moved
+// units placed, and the offset modulo the struct alignment.
+func placeMoved(units []layoutUnit, moved []int, structAlign int64) ([]int, bool) {
+	isMoved := make(map[int]bool, len(moved))
+	for _, u := range moved {
+		isMoved[u] = true
+	}
+	var kept []int
+	for u := range units {
+		if !isMoved[u] {
+			kept = append(kept, u)
+		}
+	}
+	masks := 1 << len(moved)
+	states := (len(kept) + 1) * masks * int(structAlign)
+	if states > maxExactStates {
+		return nil, false
+	}
+	memo := make([]int64, states)
+	next := func(u int, off int64) (used, o int64) {
+		used = align(off, units[u].align) - off + units[u].size
+		return used, (off + used) % structAlign
+	}
+	var best func(i, mask int, off int64) int64
+	best = func(i, mask int, off int64) int64 {
+		s := (i*masks+mask)*int(structAlign) + int(off)
+		if memo[s] > 0 {
+			return memo[s] - 1
+		}
+		min := int64(-1)
+		if i == len(kept) && mask == masks-1 {
+			min = align(off, structAlign) - off
+		}
+		if i < len(kept) {
+			used, o := next(kept[i], off)
+			min = used + best(i+1, mask, o)
+		}
+		for j, u := range moved {
+			if mask&(1<<j) != 0 {
+				continue
+			}
+			used, o := next(u, off)
+			if n := used + best(i, mask|1<<j, o); min < 0 || n < min {
+				min = n
+			}
+		}
+		memo[s] = min + 1
+		return min
+	}
+
+	// Follow the decisions of the search, keeping units in place when possible.
+	var order []int
+	i, mask, off := 0, 0, int64(0)
+	for len(order) < len(units) {
+		want := best(i, mask, off)
+		if i < len(kept) {
+			if used, o := next(kept[i], off); used+best(i+1, mask, o) == want {
+				order = append(order, kept[i])
+				i, off = i+1, o
+				continue
+			}
+		}
+		for j, u := range moved {
+			if mask&(1<<j) != 0 {
+				continue
+			}
+			if used, o := next(u, off); used+best(i, mask|1<<j, o) == want {
+				order = append(order, u)
+				mask, off = mask|1<<j, o
+				break
+			}
+		}
+	}
+	return order, true
+}
+
+// movedFields returns the fields of an order given by idx which are not part of a
+// longest run of fields keeping their relative order, that is, the fields to move
+// to get from the current order to idx.
+func movedFields(idx []int) []int {
+	// Longest increasing subsequence, in quadratic time as structs are small.
+	length := make([]int, len(idx))
+	prev := make([]int, len(idx))
+	last := -1
+	for i := range idx {
+		length[i], prev[i] = 1, -1
+		for j := 0; j < i; j++ {
+			if idx[j] < idx[i] && length[j]+1 > length[i] {
+				length[i], prev[i] = length[j]+1, j
+			}
+		}
+		if last < 0 || length[i] > length[last] {
+			last = i
+		}
+	}
+	kept := make(map[int]bool)
+	for i := last; i >= 0; i = prev[i] {
+		kept[i] = true
+	}
+	var moved []int
+	for i, j := range idx {
+		if !kept[i] {
+			moved = append(moved, j)
+		}
+	}
+	return moved
+}
+
+// fieldNames returns the names of the fields of s at the given indexes.
+func fieldNames(s *types.Struct, idx []int) []string {
+	names := make([]string, len(idx))
+	for i, j := range idx {
+		names[i] = s.Field(j).Name()
+	}
+	return names
+}
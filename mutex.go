@@ -0,0 +1,139 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+)
+
+// guardedByRe matches comments naming the mutex guarding a field.
+var guardedByRe = regexp.MustCompile(`(?i)\b(?:guarded|protected) by (\w+)`)
+
+func isMutex(f *types.Var) bool {
+	return isSyncType(f.Type(), "sync", "Mutex", "RWMutex")
+}
+
+// guardedGroups returns the group of every field of a struct, where every mutex
+// forms a group with the fields it guards, and other fields are alone in their
+// group, as well as the mutexes, which stay first in their group. By convention,
+// a mutex guards the fields following it, up to a blank line or another mutex,
+// and fields commented with "guarded by mu" or "protected by mu". It returns nil
+// when the struct has no mutex.
+func guardedGroups(fset *token.FileSet, atyp *ast.StructType, styp *types.Struct) ([]int, []bool) {
+	fields := structFields(styp)
+	heads := make([]bool, len(fields))
+	mutexes := make(map[string]int)
+	for i, f := range fields {
+		if isMutex(f) {
+			heads[i] = true
+			mutexes[f.Name()] = i
+		}
+	}
+	if len(mutexes) == 0 {
+		return nil, nil
+	}
+	blocks := fieldGroups(fset, atyp)
+	comments := fieldComments(atyp)
+
+	// Every field is first assigned the index of the field leading its group.
+	leader := make([]int, len(fields))
+	mu := -1
+	for i := range fields {
+		leader[i] = i
+		if heads[i] {
+			mu = i
+			continue
+		}
+		if m := guardedByRe.FindStringSubmatch(comments[i]); m != nil {
+			if j, ok := mutexes[m[1]]; ok {
+				leader[i] = j
+				continue
+			}
+		}
+		if mu >= 0 && blocks[i] == blocks[mu] {
+			leader[i] = mu
+		}
+	}
+
+	// Number groups in order of appearance.
+	groups := make([]int, len(fields))
+	ids := make(map[int]int)
+	for i, l := range leader {
+		id, ok := ids[l]
+		if !ok {
+			id = len(ids)
+			ids[l] = id
+		}
+		groups[i] = id
+	}
+	return groups, heads
+}
+
+// groupMutexes returns the mutexes which lead their group, and stay first in it.
+func groupMutexes(styp *types.Struct, groups []int) []bool {
+	fields := structFields(styp)
+	heads := make([]bool, len(fields))
+	for i, f := range fields {
+		heads[i] = isMutex(f) && (i == 0 || groups[i] != groups[i-1])
+	}
+	return heads
+}
+
+// fieldComments returns the doc and line comments of every field of atyp.
+func fieldComments(atyp *ast.StructType) []string {
+	var comments []string
+	for _, f := range atyp.Fields.List {
+		text := f.Doc.Text() + f.Comment.Text()
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			comments = append(comments, text)
+		}
+	}
+	return comments
+}
+
+// guardedSpacing returns the groups of fields separated by blank lines once a
+// struct is rearranged to the order idx with the groups of guardedGroups: every
+// mutex with the fields it guards, and every run of unguarded fields in the new
+// order, so that unguarded fields moved below a mutex are not taken as guarded.
+func guardedSpacing(groups []int, heads []bool, idx []int) []int {
+	guarded := make(map[int]bool)
+	for i, h := range heads {
+		if h {
+			guarded[groups[i]] = true
+		}
+	}
+	spacing := make([]int, len(groups))
+	run := 0
+	for k, i := range idx {
+		g := groups[i]
+		if guarded[g] {
+			spacing[i] = g
+			continue
+		}
+		// Unguarded runs are numbered below zero, apart from the groups.
+		if k == 0 || guarded[groups[idx[k-1]]] {
+			run--
+		}
+		spacing[i] = run
+	}
+	return spacing
+}
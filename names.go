@@ -0,0 +1,126 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// structNames returns the qualified name of every struct type of files, derived
+// from the enclosing declarations: pkg.T for declared types, pkg.T.field for
+// anonymous struct fields, pkg.Func.T for types local to functions, and for
+// function literals, the names the compiler gives them: pkg.Func.func1, and
+// pkg.Func.func1.1 for a function literal nested in it, or pkg.init.func1 in
+// package variables.
+func structNames(pkgPath string, files []*ast.File) map[*ast.StructType]string {
+	names := make(map[*ast.StructType]string)
+	closures := make(map[string]int) // number of function literals in every function
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fn := pkgPath + ".init"
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				fn = qualifiedName(pkgPath, []string{nodeName(fd)})
+			}
+			scopes := []*nameScope{{name: pkgPath}}
+			var stack []ast.Node
+			ast.Inspect(decl, func(n ast.Node) bool {
+				s := scopes[len(scopes)-1]
+				if n == nil {
+					if _, ok := stack[len(stack)-1].(*ast.FuncLit); ok {
+						scopes = scopes[:len(scopes)-1]
+					} else {
+						s.path = s.path[:len(s.path)-1]
+					}
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				stack = append(stack, n)
+				if _, ok := n.(*ast.FuncLit); ok {
+					outer, format := fn, "%s.func%d"
+					if len(scopes) > 1 {
+						outer, format = s.name, "%s.%d"
+					}
+					closures[outer]++
+					scopes = append(scopes, &nameScope{name: fmt.Sprintf(format, outer, closures[outer])})
+					return true
+				}
+				s.path = append(s.path, nodeName(n))
+				if atyp, ok := n.(*ast.StructType); ok {
+					names[atyp] = qualifiedName(s.name, s.path)
+				}
+				return true
+			})
+		}
+	}
+	return names
+}
+
+// nameScope is the qualified name of a function literal, or of the package, and
+// the name of every node on the path from it to the current node, if any.
+type nameScope struct {
+	name string
+	path []string
+}
+
+// nodeName returns the name n gives to the nodes it encloses, if any.
+func nodeName(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		if n.Recv != nil && len(n.Recv.List) > 0 {
+			return receiverName(n.Recv.List[0].Type) + "." + n.Name.Name
+		}
+		return n.Name.Name
+	case *ast.TypeSpec:
+		return n.Name.Name
+	case *ast.ValueSpec:
+		return n.Names[0].Name
+	case *ast.Field:
+		if len(n.Names) > 0 {
+			return n.Names[0].Name
+		}
+	}
+	return ""
+}
+
+// receiverName returns the name of the type of a method receiver.
+func receiverName(expr ast.Expr) string {
+	switch e := astutil.Unparen(expr).(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.IndexListExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// qualifiedName joins prefix, a package path or the name of a function literal,
+// and the names of path.
+func qualifiedName(prefix string, path []string) string {
+	parts := []string{prefix}
+	for _, p := range path {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,369 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// timestampMethods are the time.Time methods which an int64 of Unix nanoseconds
+// can stand for.
+var timestampMethods = map[string]bool{
+	"After":     true,
+	"Before":    true,
+	"Compare":   true,
+	"Equal":     true,
+	"IsZero":    true,
+	"Sub":       true,
+	"Unix":      true,
+	"UnixMicro": true,
+	"UnixMilli": true,
+	"UnixNano":  true,
+}
+
+// fieldUse records how the code of a package uses a struct field.
+type fieldUse struct {
+	constants bool            // set to or compared with constants
+	min, max  int64           // range of these constants and zero
+	nonConst  bool            // set to non-constant values, or incremented
+	addressed bool            // address taken
+	other     bool            // used as a value, except compared with constants, or calling methods other than timestampMethods
+	methods   map[string]bool // timestampMethods called
+}
+
+func (fu *fieldUse) constant(v constant.Value) {
+	n, ok := constant.Int64Val(constant.ToInt(v))
+	if !ok {
+		fu.nonConst = true
+		return
+	}
+	// The range starts with zero, the value of unset fields.
+	if n < fu.min {
+		fu.min = n
+	}
+	if n > fu.max {
+		fu.max = n
+	}
+	fu.constants = true
+}
+
+type fieldUses map[*types.Var]*fieldUse
+
+func (u fieldUses) get(f *types.Var) *fieldUse {
+	f = f.Origin()
+	fu := u[f]
+	if fu == nil {
+		fu = &fieldUse{methods: make(map[string]bool)}
+		u[f] = fu
+	}
+	return fu
+}
+
+// narrowingUses returns how the struct fields are used by the package, to know
+// which ones can get narrower types.
+func narrowingUses(pass *analysis.Pass, inspect *inspector.Inspector) fieldUses {
+	uses := make(fieldUses)
+	set := func(fu *fieldUse, e ast.Expr) {
+		if tv, ok := pass.TypesInfo.Types[e]; ok && tv.Value != nil {
+			fu.constant(tv.Value)
+		} else {
+			fu.nonConst = true
+		}
+	}
+	nodeFilter := []ast.Node{
+		(*ast.SelectorExpr)(nil),
+		(*ast.CompositeLit)(nil),
+	}
+	inspect.WithStack(nodeFilter, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		if lit, ok := n.(*ast.CompositeLit); ok {
+			styp, ok := pass.TypesInfo.TypeOf(lit).Underlying().(*types.Struct)
+			if !ok {
+				return true
+			}
+			for i, elt := range lit.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						if f, ok := pass.TypesInfo.Uses[key].(*types.Var); ok {
+							set(uses.get(f), kv.Value)
+						}
+					}
+				} else if i < styp.NumFields() {
+					set(uses.get(styp.Field(i)), elt)
+				}
+			}
+			return true
+		}
+
+		sel := n.(*ast.SelectorExpr)
+		s := pass.TypesInfo.Selections[sel]
+		if s == nil || s.Kind() != types.FieldVal {
+			return true
+		}
+		fu := uses.get(s.Obj().(*types.Var))
+		var e ast.Node = sel
+		i := len(stack) - 2
+		for ; i >= 0; i-- {
+			if _, ok := stack[i].(*ast.ParenExpr); !ok {
+				break
+			}
+			e = stack[i]
+		}
+		if i < 0 {
+			return true
+		}
+		switch p := stack[i].(type) {
+		case *ast.AssignStmt:
+			for j, lhs := range p.Lhs {
+				if lhs != e {
+					continue
+				}
+				if (p.Tok == token.ASSIGN || p.Tok == token.DEFINE) && len(p.Lhs) == len(p.Rhs) {
+					set(fu, p.Rhs[j])
+				} else {
+					fu.nonConst = true
+				}
+				return true
+			}
+			fu.other = true
+		case *ast.IncDecStmt:
+			fu.nonConst = true
+		case *ast.RangeStmt:
+			if p.Key == e || p.Value == e {
+				fu.nonConst = true
+			} else {
+				fu.other = true
+			}
+		case *ast.UnaryExpr:
+			if p.Op == token.AND {
+				fu.addressed = true
+			}
+			fu.other = true
+		case *ast.BinaryExpr:
+			switch p.Op {
+			case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+				other := p.X
+				if other == e {
+					other = p.Y
+				}
+				if tv, ok := pass.TypesInfo.Types[other]; ok && tv.Value != nil {
+					fu.constant(tv.Value)
+					return true
+				}
+			}
+			fu.other = true
+		case *ast.SwitchStmt:
+			if p.Tag != e {
+				return true
+			}
+			for _, stmt := range p.Body.List {
+				for _, c := range stmt.(*ast.CaseClause).List {
+					if tv, ok := pass.TypesInfo.Types[c]; ok && tv.Value != nil {
+						fu.constant(tv.Value)
+					} else {
+						fu.other = true
+					}
+				}
+			}
+		case *ast.SelectorExpr:
+			if name := p.Sel.Name; timestampMethods[name] {
+				fu.methods[name] = true
+			} else {
+				fu.other = true
+			}
+		default:
+			fu.other = true
+		}
+		return true
+	})
+	return uses
+}
+
+// narrowing is a suggested narrower type for struct fields.
+type narrowing struct {
+	fields []int // indexes of the fields, packed together when there are many
+	typ    types.Type
+	named  *types.TypeName // named integer type of the field, whose underlying type is narrowed
+	reason string
+}
+
+// narrowings returns the narrower types which the unexported fields of styp could
+// have, given how uses shows they are used: integers only set to and compared with
+// constants fit in the smallest integer type holding them, many bools fit in bit
+// flags, and time.Time values only compared or converted to Unix times fit in an
+// int64 of nanoseconds. Fields of a named integer type of pkg, like an enum, keep
+// their type, whose underlying type is narrowed instead, to hold its constants too.
+func narrowings(sizes types.Sizes, pkg *types.Package, styp *types.Struct, uses fieldUses) []narrowing {
+	var ns []narrowing
+	var bools []int
+	for i, f := range structFields(styp) {
+		if f.Exported() || f.Embedded() || styp.Tag(i) != "" {
+			continue
+		}
+		fu := uses[f.Origin()]
+		if fu == nil {
+			fu = &fieldUse{}
+		}
+		switch T := f.Type().Underlying().(type) {
+		case *types.Basic:
+			switch {
+			case T.Kind() == types.Bool && f.Type() == T:
+				if !fu.addressed {
+					bools = append(bools, i)
+				}
+			case T.Info()&types.IsInteger != 0 && T.Kind() != types.Uintptr:
+				if !fu.constants || fu.nonConst || fu.addressed || fu.other {
+					continue
+				}
+				min, max := fu.min, fu.max
+				var named *types.TypeName
+				if n, ok := f.Type().(*types.Named); ok {
+					if named = n.Obj(); named.Pkg() != pkg {
+						continue
+					}
+					var ok bool
+					if min, max, ok = constantsRange(pkg, n, min, max); !ok {
+						continue
+					}
+				}
+				nt := narrowestInt(min, max, T.Info()&types.IsUnsigned != 0)
+				if nt != nil && sizes.Sizeof(nt) < sizes.Sizeof(T) {
+					ns = append(ns, narrowing{
+						fields: []int{i},
+						typ:    nt,
+						named:  named,
+						reason: fmt.Sprintf("only set to and compared with constants from %d to %d", min, max),
+					})
+				}
+			}
+		case *types.Struct:
+			if !isSyncType(f.Type(), "time", "Time") || fu.addressed || fu.other {
+				continue
+			}
+			reason := "only assigned"
+			if len(fu.methods) > 0 {
+				methods := make([]string, 0, len(fu.methods))
+				for m := range fu.methods {
+					methods = append(methods, m)
+				}
+				sort.Strings(methods)
+				reason = "only used through " + strings.Join(methods, ", ")
+			}
+			ns = append(ns, narrowing{fields: []int{i}, typ: types.Typ[types.Int64], reason: reason})
+		}
+	}
+	if len(bools) >= 2 && len(bools) <= 64 {
+		ns = append(ns, narrowing{fields: bools, typ: narrowestInt(0, 1<<len(bools)-1, true), reason: "bit flags"})
+	}
+	sort.Slice(ns, func(i, j int) bool { return ns[i].fields[0] < ns[j].fields[0] })
+	return ns
+}
+
+// constantsRange extends [min, max] to the package level constants of type T of
+// pkg. It reports false if one of them is not a 64-bit integer.
+func constantsRange(pkg *types.Package, T types.Type, min, max int64) (int64, int64, bool) {
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		c, ok := scope.Lookup(name).(*types.Const)
+		if !ok || !types.Identical(c.Type(), T) {
+			continue
+		}
+		n, ok := constant.Int64Val(constant.ToInt(c.Val()))
+		if !ok {
+			return 0, 0, false
+		}
+		if n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return min, max, true
+}
+
+// narrowestInt returns the smallest integer type holding [min, max], or nil.
+func narrowestInt(min, max int64, unsigned bool) types.Type {
+	signedKinds := []types.BasicKind{types.Int8, types.Int16, types.Int32, types.Int64}
+	unsignedKinds := []types.BasicKind{types.Uint8, types.Uint16, types.Uint32, types.Uint64}
+	for i, bits := range []uint{8, 16, 32, 64} {
+		if unsigned {
+			if min >= 0 && (bits == 64 || max < 1<<bits) {
+				return types.Typ[unsignedKinds[i]]
+			}
+		} else if bits == 64 || min >= -1<<(bits-1) && max < 1<<(bits-1) {
+			return types.Typ[signedKinds[i]]
+		}
+	}
+	return nil
+}
+
+// narrowedStruct returns styp with the narrower types of ns. Packed fields are
+// replaced with a single field, at the position of the first one.
+func narrowedStruct(styp *types.Struct, ns []narrowing) *types.Struct {
+	replaced := make(map[int]*narrowing)
+	for i := range ns {
+		for _, j := range ns[i].fields {
+			replaced[j] = &ns[i]
+		}
+	}
+	var fields []*types.Var
+	for i, f := range structFields(styp) {
+		n := replaced[i]
+		switch {
+		case n == nil:
+			fields = append(fields, f)
+		case n.fields[0] == i:
+			name := f.Name()
+			if len(n.fields) > 1 {
+				name = "flags"
+			}
+			fields = append(fields, types.NewField(f.Pos(), f.Pkg(), name, n.typ, false))
+		}
+	}
+	return types.NewStruct(fields, nil)
+}
+
+// narrowMessage lists the narrowings of the fields of styp.
+func narrowMessage(styp *types.Struct, ns []narrowing, qf types.Qualifier) string {
+	var b strings.Builder
+	for _, n := range ns {
+		names := fieldNames(styp, n.fields)
+		from := types.TypeString(styp.Field(n.fields[0]).Type(), qf)
+		to := types.TypeString(n.typ, qf)
+		if len(n.fields) > 1 {
+			fmt.Fprintf(&b, "\t%s: %s in a %s instead of %s fields\n", strings.Join(names, ", "), n.reason, to, from)
+			continue
+		}
+		if n.named != nil {
+			// The named type is kept, with a narrower underlying type.
+			from = types.TypeString(n.named.Type().Underlying(), qf)
+			to = "type " + n.named.Name() + " " + to
+		}
+		fmt.Fprintf(&b, "\t%s: %s instead of %s, %s\n", names[0], to, from, n.reason)
+	}
+	return b.String()
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// nestedPlans computes, with -recursive, the orders of the struct declarations of
+// a package which also rearrange the struct types nested in them: anonymous struct
+// fields, fields of struct types declared in the package, and arrays of them.
+type nestedPlans struct {
+	pass        *analysis.Pass
+	targets     []target
+	named       map[*types.TypeName]*ast.StructType              // struct types declared in the package
+	names       map[*ast.StructType]string                       // type or field names of declarations
+	skip        func(*ast.StructType) bool                       // declarations which keep their order
+	constraints func(*ast.StructType, *types.Struct) constraints // of every declaration
+	plans       map[*ast.StructType]*nestedPlan
+}
+
+// nestedPlan is the planned order of a struct declaration, whose nested struct
+// types are rearranged too.
+type nestedPlan struct {
+	results []result          // against the current layout of the struct
+	opt     *types.Struct     // with the nested struct types rearranged, in the planned order
+	nested  []*ast.StructType // declarations of the nested struct types which change
+}
+
+// changed reports whether the layout of the struct changes with the plan.
+func (p *nestedPlan) changed() bool {
+	return len(p.nested) > 0 || !sameOrder(p.results[0].optIdx)
+}
+
+func newNestedPlans(pass *analysis.Pass, targets []target, specs map[*ast.StructType]*ast.TypeSpec, skip func(*ast.StructType) bool, constraints func(*ast.StructType, *types.Struct) constraints) *nestedPlans {
+	np := &nestedPlans{
+		pass:        pass,
+		targets:     targets,
+		named:       make(map[*types.TypeName]*ast.StructType),
+		names:       make(map[*ast.StructType]string),
+		skip:        skip,
+		constraints: constraints,
+		plans:       make(map[*ast.StructType]*nestedPlan),
+	}
+	for atyp, spec := range specs {
+		np.names[atyp] = spec.Name.Name
+		// The layout of generic structs depends on their type arguments.
+		if spec.TypeParams != nil {
+			np.plans[atyp] = nil
+			continue
+		}
+		if obj, ok := pass.TypesInfo.Defs[spec.Name].(*types.TypeName); ok {
+			np.named[obj] = atyp
+		}
+	}
+	return np
+}
+
+// plan returns the plan of a struct declaration, or nil when it keeps its order,
+// or without -recursive.
+func (np *nestedPlans) plan(atyp *ast.StructType) *nestedPlan {
+	if np == nil {
+		return nil
+	}
+	if p, ok := np.plans[atyp]; ok {
+		return p
+	}
+	np.plans[atyp] = nil
+	styp, ok := np.pass.TypesInfo.Types[atyp].Type.(*types.Struct)
+	if !ok || np.skip(atyp) {
+		return nil
+	}
+
+	// Replace the nested struct types with their planned layout.
+	fields := structFields(styp)
+	decls := fieldDecls(atyp)
+	subst := make([]*types.Var, len(fields))
+	tags := make([]string, len(fields))
+	var nested []*ast.StructType
+	seen := make(map[*ast.StructType]bool)
+	for i, f := range fields {
+		subst[i], tags[i] = f, styp.Tag(i)
+		d := np.declaration(atyp.Fields.List[decls[i]].Type, f.Type())
+		if d == nil {
+			continue
+		}
+		if _, ok := np.names[d]; !ok {
+			np.names[d] = f.Name()
+		}
+		p := np.plan(d)
+		if p == nil || !p.changed() {
+			continue
+		}
+		subst[i] = types.NewField(f.Pos(), f.Pkg(), f.Name(), replaceStruct(f.Type(), p.opt), f.Embedded())
+		if !seen[d] {
+			seen[d] = true
+			nested = append(nested, d)
+		}
+	}
+	sstyp := types.NewStruct(subst, tags)
+
+	// Only rearrange the fields when it saves space, once nested types are
+	// rearranged.
+	results := checkTargets(np.targets, sstyp, np.constraints(atyp, sstyp))
+	identity := make([]int, len(fields))
+	for i := range identity {
+		identity[i] = i
+	}
+	reorder := false
+	for i, t := range np.targets {
+		kept := arrange(t, sstyp, identity)
+		reorder = reorder || results[i].newGcSize < kept.newGcSize || results[i].newPtrdata < kept.newPtrdata
+	}
+	p := &nestedPlan{nested: nested}
+	for i, t := range np.targets {
+		if !reorder {
+			results[i] = arrange(t, sstyp, identity)
+			results[i].proven = provenOptimal(t, sstyp, results[i].newGcSize)
+		}
+		if i == 0 {
+			p.opt = results[i].optStruct
+		}
+		// Sizes are compared to the current layout, and the suggested order
+		// shows the declared field types, but for anonymous structs.
+		results[i].oldGcSize = t.sizes.Sizeof(styp)
+		results[i].oldRuntimeSize = t.runtimeSize(styp)
+		if gcPtrdata {
+			results[i].oldPtrdata = ptrdata(t.sizes, styp)
+		}
+		optFields := make([]*types.Var, len(fields))
+		for j, k := range results[i].optIdx {
+			optFields[j] = fields[k]
+			if _, ok := dataType(fields[k].Type()).(*types.Struct); ok {
+				optFields[j] = subst[k]
+			}
+		}
+		results[i].optStruct = types.NewStruct(optFields, nil)
+	}
+	p.results = results
+	np.plans[atyp] = p
+	return p
+}
+
+// declaration returns the declaration of the struct type of a field, given its
+// type expression and type, looking through arrays, or nil.
+func (np *nestedPlans) declaration(expr ast.Expr, T types.Type) *ast.StructType {
+loop:
+	for {
+		switch e := expr.(type) {
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.ArrayType:
+			if e.Len == nil {
+				return nil
+			}
+			expr = e.Elt
+		case *ast.StructType:
+			return e
+		default:
+			break loop
+		}
+	}
+	for {
+		a, ok := T.(*types.Array)
+		if !ok {
+			break
+		}
+		T = a.Elem()
+	}
+	named, ok := T.(*types.Named)
+	if !ok || named.TypeArgs().Len() > 0 {
+		return nil
+	}
+	return np.named[named.Obj()]
+}
+
+// all returns the declarations of the struct types nested in atyp which change
+// with its plan, at any depth.
+func (np *nestedPlans) all(atyp *ast.StructType) []*ast.StructType {
+	var nested []*ast.StructType
+	seen := make(map[*ast.StructType]bool)
+	var visit func(*ast.StructType)
+	visit = func(atyp *ast.StructType) {
+		p := np.plan(atyp)
+		if p == nil {
+			return
+		}
+		for _, d := range p.nested {
+			if !seen[d] {
+				seen[d] = true
+				nested = append(nested, d)
+				visit(d)
+			}
+		}
+	}
+	visit(atyp)
+	return nested
+}
+
+// replaceStruct returns T, a struct type or an array of them, with the struct type
+// replaced by s.
+func replaceStruct(T types.Type, s *types.Struct) types.Type {
+	if a, ok := T.(*types.Array); ok {
+		return types.NewArray(replaceStruct(a.Elem(), s), a.Len())
+	}
+	return s
+}
@@ -0,0 +1,429 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// orderAnalyzer finds the struct types whose fields order is relied upon. It exports
+// facts, so it runs on the dependencies of the analyzed packages too, which is why
+// it is separate from Analyzer.
+var orderAnalyzer = &analysis.Analyzer{
+	Name:       "structslop_order",
+	Doc:        "find struct types whose fields order is relied upon",
+	Requires:   []*analysis.Analyzer{inspect.Analyzer},
+	Run:        runOrder,
+	ResultType: reflect.TypeOf(new(orderSites)),
+	FactTypes:  []analysis.Fact{new(orderSinkFact)},
+}
+
+// orderSinkFact is exported for functions passing some of their parameters to code
+// relying on their fields order, like binary.Write.
+type orderSinkFact struct {
+	Params []int
+}
+
+func (*orderSinkFact) AFact() {}
+
+func (f *orderSinkFact) String() string {
+	return fmt.Sprintf("orderSink(%v)", f.Params)
+}
+
+// orderSite is a place relying on the fields order of a struct.
+type orderSite struct {
+	pos    token.Pos
+	reason string
+	lit    *ast.CompositeLit // unkeyed composite literal, which can be converted to keyed form
+}
+
+// orderSites maps struct types of a package to the sites relying on their fields
+// order. Named types are keyed by their origin type, unnamed ones by their struct.
+type orderSites struct {
+	m typeutil.Map
+}
+
+func (s *orderSites) add(T types.Type, pos token.Pos, reason string) {
+	s.addSite(T, orderSite{pos: pos, reason: reason})
+}
+
+func (s *orderSites) addSite(T types.Type, site orderSite) {
+	if T = orderKey(T); T == nil {
+		return
+	}
+	sites, _ := s.m.At(T).([]orderSite)
+	s.m.Set(T, append(sites, site))
+}
+
+// lookup returns the sites relying on the fields order of T, sorted by position.
+func (s *orderSites) lookup(T types.Type) []orderSite {
+	if T = orderKey(T); T == nil {
+		return nil
+	}
+	sites, _ := s.m.At(T).([]orderSite)
+	sort.Slice(sites, func(i, j int) bool { return sites[i].pos < sites[j].pos })
+	return sites
+}
+
+// orderKey returns the struct type T is keyed by in orderSites, or nil if T is not a
+// struct type.
+func orderKey(T types.Type) types.Type {
+	if _, ok := T.Underlying().(*types.Struct); !ok {
+		return nil
+	}
+	if named, ok := T.(*types.Named); ok {
+		return named.Origin()
+	}
+	return T.Underlying()
+}
+
+// dataType returns the type of values stored in T: the element type of pointers,
+// slices and arrays.
+func dataType(T types.Type) types.Type {
+	for {
+		switch t := T.Underlying().(type) {
+		case *types.Pointer:
+			T = t.Elem()
+		case *types.Slice:
+			T = t.Elem()
+		case *types.Array:
+			T = t.Elem()
+		default:
+			return T
+		}
+	}
+}
+
+// binarySinks are the encoding/binary functions relying on the fields order of
+// their data argument, with the index of that argument.
+var binarySinks = map[string]int{
+	"Read":   2,
+	"Write":  2,
+	"Size":   0,
+	"Append": 2,
+	"Encode": 2,
+	"Decode": 2,
+}
+
+func runOrder(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	sites := new(orderSites)
+
+	// Find the parameters which functions of the package pass to sinks, until no
+	// more are found, as functions may call each other.
+	sinks := make(map[*types.Func][]int)
+	sinkParams := func(fn *types.Func) []int {
+		if params, ok := sinks[fn]; ok {
+			return params
+		}
+		var f orderSinkFact
+		if fn.Pkg() != pass.Pkg && pass.ImportObjectFact(fn, &f) {
+			return f.Params
+		}
+		return nil
+	}
+	var funcs []*ast.FuncDecl
+	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		funcs = append(funcs, n.(*ast.FuncDecl))
+	})
+	for changed := true; changed; {
+		changed = false
+		for _, decl := range funcs {
+			fn, ok := pass.TypesInfo.Defs[decl.Name].(*types.Func)
+			if !ok || decl.Body == nil {
+				continue
+			}
+			params := paramIndexes(pass, decl)
+			found := make(map[int]bool)
+			for _, i := range sinks[fn] {
+				found[i] = true
+			}
+			n := len(found)
+			ast.Inspect(decl.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				for _, arg := range sinkArgs(pass, call, sinkParams) {
+					if id, ok := astutil.Unparen(arg).(*ast.Ident); ok {
+						if i, ok := params[pass.TypesInfo.Uses[id]]; ok {
+							found[i] = true
+						}
+					}
+				}
+				return true
+			})
+			if len(found) > n {
+				changed = true
+				sinks[fn] = sinks[fn][:0]
+				for i := range found {
+					sinks[fn] = append(sinks[fn], i)
+				}
+				sort.Ints(sinks[fn])
+			}
+		}
+	}
+	for fn, params := range sinks {
+		pass.ExportObjectFact(fn, &orderSinkFact{Params: params})
+	}
+
+	// Functions without body are implemented in assembly only if the package
+	// has assembly files; otherwise they are pulled in with go:linkname.
+	hasAsm := false
+	for _, name := range pass.OtherFiles {
+		if strings.HasSuffix(name, ".s") {
+			hasAsm = true
+		}
+	}
+
+	nodeFilter := []ast.Node{
+		(*ast.CompositeLit)(nil),
+		(*ast.CallExpr)(nil),
+		(*ast.FuncDecl)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.CompositeLit:
+			if len(n.Elts) == 0 {
+				return
+			}
+			if _, ok := n.Elts[0].(*ast.KeyValueExpr); ok {
+				return
+			}
+			// Literals with an elided &T type have type *T.
+			T := pass.TypesInfo.TypeOf(n)
+			if ptr, ok := T.Underlying().(*types.Pointer); ok {
+				T = ptr.Elem()
+			}
+			sites.addSite(T, orderSite{pos: n.Pos(), reason: "unkeyed composite literal", lit: n})
+		case *ast.CallExpr:
+			if name, ok := sinkName(pass, n, sinkParams); ok {
+				for _, arg := range sinkArgs(pass, n, sinkParams) {
+					sites.add(dataType(pass.TypesInfo.TypeOf(arg)), arg.Pos(), "passed to "+name)
+				}
+			}
+			orderCallSites(pass, sites, n)
+		case *ast.FuncDecl:
+			fn, ok := pass.TypesInfo.Defs[n.Name].(*types.Func)
+			if !ok || n.Body != nil || !hasAsm || hasDirective(n.Doc, "//go:linkname") {
+				return
+			}
+			sig := fn.Type().(*types.Signature)
+			for i := 0; i < sig.Params().Len(); i++ {
+				sites.add(dataType(sig.Params().At(i).Type()), n.Pos(), "passed to assembly function "+fn.Name())
+			}
+		}
+	})
+	return sites, nil
+}
+
+// orderCallSites records the structs whose fields are located with unsafe.Offsetof,
+// or whose memory is reinterpreted by a conversion through unsafe.Pointer, like
+// cgo mirrors of C structs: (*C.struct_t)(unsafe.Pointer(&t)).
+func orderCallSites(pass *analysis.Pass, sites *orderSites, call *ast.CallExpr) {
+	if len(call.Args) != 1 {
+		return
+	}
+	arg := astutil.Unparen(call.Args[0])
+	if b, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Builtin); ok && b.Name() == "Offsetof" {
+		if sel, ok := arg.(*ast.SelectorExpr); ok {
+			if s := pass.TypesInfo.Selections[sel]; s != nil {
+				sites.add(dataType(s.Recv()), call.Pos(), "unsafe.Offsetof")
+			}
+		}
+		return
+	}
+	tv, ok := pass.TypesInfo.Types[call.Fun]
+	if !ok || !tv.IsType() {
+		return
+	}
+	if _, ok := tv.Type.Underlying().(*types.Pointer); !ok {
+		return
+	}
+	conv, ok := arg.(*ast.CallExpr)
+	if !ok || len(conv.Args) != 1 || !types.Identical(pass.TypesInfo.TypeOf(conv), types.Typ[types.UnsafePointer]) {
+		return
+	}
+	from := pass.TypesInfo.TypeOf(conv.Args[0])
+	if _, ok := from.Underlying().(*types.Pointer); ok {
+		sites.add(dataType(from), call.Pos(), "converted through unsafe.Pointer")
+	}
+	sites.add(dataType(tv.Type), call.Pos(), "converted through unsafe.Pointer")
+}
+
+// sinkName returns the name of the function called by call, if it relies on the
+// fields order of some of its arguments.
+func sinkName(pass *analysis.Pass, call *ast.CallExpr, sinkParams func(*types.Func) []int) (string, bool) {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return "", false
+	}
+	if fn.Pkg().Path() == "encoding/binary" {
+		_, ok := binarySinks[fn.Name()]
+		return "binary." + fn.Name(), ok
+	}
+	if len(sinkParams(fn)) == 0 {
+		return "", false
+	}
+	if fn.Pkg() == pass.Pkg {
+		return fn.Name(), true
+	}
+	return fn.Pkg().Name() + "." + fn.Name(), true
+}
+
+// sinkArgs returns the arguments of call whose fields order is relied upon by the
+// called function.
+func sinkArgs(pass *analysis.Pass, call *ast.CallExpr, sinkParams func(*types.Func) []int) []ast.Expr {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return nil
+	}
+	var idx []int
+	if fn.Pkg().Path() == "encoding/binary" {
+		if i, ok := binarySinks[fn.Name()]; ok {
+			idx = []int{i}
+		}
+	} else {
+		idx = sinkParams(fn)
+	}
+	var args []ast.Expr
+	for _, i := range idx {
+		if i < len(call.Args) {
+			args = append(args, call.Args[i])
+		}
+	}
+	return args
+}
+
+// orderMessage lists the sites relying on the fields order of a struct.
+func orderMessage(fset *token.FileSet, sites []orderSite) string {
+	var b strings.Builder
+	b.WriteString("fields order is relied upon by:")
+	for _, s := range orderSiteStrings(fset, sites) {
+		b.WriteString("\n\t" + s)
+	}
+	return b.String()
+}
+
+// orderSiteStrings formats sites, without duplicates.
+func orderSiteStrings(fset *token.FileSet, sites []orderSite) []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, s := range sites {
+		str := fmt.Sprintf("%s: %s", fset.Position(s.pos), s.reason)
+		if !seen[str] {
+			seen[str] = true
+			list = append(list, str)
+		}
+	}
+	return list
+}
+
+// splitOrderSites separates the unkeyed composite literals of styp from the other
+// sites, which cannot be rewritten. Literals cannot be keyed when styp has blank
+// fields, they are then returned with the other sites.
+func splitOrderSites(styp *types.Struct, sites []orderSite) (lits []*ast.CompositeLit, others []orderSite) {
+	for i := 0; i < styp.NumFields(); i++ {
+		if styp.Field(i).Name() == "_" {
+			return nil, sites
+		}
+	}
+	for _, s := range sites {
+		if s.lit != nil {
+			lits = append(lits, s.lit)
+		} else {
+			others = append(others, s)
+		}
+	}
+	return lits, others
+}
+
+// importedOrderDiagnostics returns diagnostics for the sites of the package relying
+// on the fields order of named struct types of other packages which are sloppy on
+// target t, as rearranging them in their package would break these sites, which
+// the analysis of that package cannot see. Unkeyed composite literals get a fix
+// converting them to keyed form.
+func importedOrderDiagnostics(pass *analysis.Pass, facts *layoutFacts, t target, sites *orderSites) []analysis.Diagnostic {
+	qf := qualifier(pass.Pkg.Path())
+	var diags []analysis.Diagnostic
+	for _, T := range sites.m.Keys() {
+		named, ok := T.(*types.Named)
+		if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg() == pass.Pkg || named.TypeParams().Len() > 0 {
+			continue
+		}
+		styp := named.Underlying().(*types.Struct)
+		var c constraints
+		if f := facts.lookup(named); f != nil {
+			// The package of the type does not suggest rearranging it.
+			if f.Ignored || f.OrderSensitive {
+				continue
+			}
+			c = f.constraints(styp)
+		}
+		r := checkSloppy(t, styp, c)
+		if !worthReporting([]result{r}, named.Obj().Pkg().Path()) {
+			continue
+		}
+		for _, s := range sites.lookup(named) {
+			d := analysis.Diagnostic{
+				Pos:      s.pos,
+				Category: categoryOrder,
+				Message: fmt.Sprintf(
+					"%s relies on the fields order of %s, which has size %d (size class %d), could be %d (size class %d) if rearranged in its package",
+					s.reason, types.TypeString(named, qf), r.oldGcSize, r.oldRuntimeSize, r.newGcSize, r.newRuntimeSize,
+				),
+			}
+			if s.lit != nil {
+				d.End = s.lit.End()
+				d.SuggestedFixes = []analysis.SuggestedFix{{
+					Message:   "Convert to keyed fields",
+					TextEdits: keyedLiteralEdits(styp, []*ast.CompositeLit{s.lit}),
+				}}
+			}
+			diags = append(diags, d)
+		}
+	}
+	sort.Slice(diags, func(i, j int) bool { return diags[i].Pos < diags[j].Pos })
+	return diags
+}
+
+// paramIndexes maps the parameters of decl to their index.
+func paramIndexes(pass *analysis.Pass, decl *ast.FuncDecl) map[types.Object]int {
+	params := make(map[types.Object]int)
+	i := 0
+	for _, field := range decl.Type.Params.List {
+		if len(field.Names) == 0 {
+			i++
+			continue
+		}
+		for _, name := range field.Names {
+			params[pass.TypesInfo.Defs[name]] = i
+			i++
+		}
+	}
+	return params
+}
@@ -0,0 +1,360 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Output formats.
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatSARIF = "sarif"
+)
+
+// record is the structured report of a struct, for the first target. Other targets
+// are listed in Targets when sizes are computed for many of them.
+type record struct {
+	File             string   `json:"file"`
+	Line             int      `json:"line"`
+	Column           int      `json:"column"`
+	Package          string   `json:"package"`
+	Name             string   `json:"name"`
+	Type             string   `json:"type,omitempty"`
+	Instance         string   `json:"instance,omitempty"`
+	Goarch           string   `json:"goarch"`
+	Size             int64    `json:"size"`
+	SizeClass        int64    `json:"size_class"`
+	OptimalSize      int64    `json:"optimal_size"`
+	OptimalSizeClass int64    `json:"optimal_size_class"`
+	Savings          float64  `json:"savings"`
+	Ptrdata          int64    `json:"ptrdata,omitempty"`
+	OptimalPtrdata   int64    `json:"optimal_ptrdata,omitempty"`
+	Sloppy           bool     `json:"sloppy"`
+	ProvenOptimal    bool     `json:"proven_optimal"`
+	Fields           []string `json:"fields"`
+	OptimalFields    []string `json:"optimal_fields"`
+	MovedFields      []string `json:"moved_fields,omitempty"`
+	Message          string   `json:"message"`
+	OrderSensitive   []string `json:"order_sensitive,omitempty"`
+	ImportedSloppy   []string `json:"imported_sloppy,omitempty"` // fields holding sloppy types of other packages
+	HeapAllocations  int64    `json:"heap_allocations,omitempty"`
+	HeapSavings      int64    `json:"heap_savings,omitempty"`
+	Targets          []record `json:"targets,omitempty"`
+}
+
+// newRecord returns the record of a struct with the given results of checkTargets,
+// and the sites relying on its fields order.
+func newRecord(pass *analysis.Pass, rep *report, typeName string, targets []target, results []result, sites []orderSite) record {
+	pos := pass.Fset.Position(rep.diag.Pos)
+	recs := make([]record, len(targets))
+	for i, t := range targets {
+		r := results[i]
+		recs[i] = record{
+			Goarch:           t.goarch,
+			Instance:         t.instance,
+			Size:             r.oldGcSize,
+			SizeClass:        r.oldRuntimeSize,
+			OptimalSize:      r.newGcSize,
+			OptimalSizeClass: r.newRuntimeSize,
+			Ptrdata:          r.oldPtrdata,
+			OptimalPtrdata:   r.newPtrdata,
+			Sloppy:           r.sloppy() && meetsThresholds(r, pass.Pkg.Path()),
+			ProvenOptimal:    r.proven,
+		}
+		if r.oldRuntimeSize > r.newRuntimeSize {
+			recs[i].Savings = r.savings()
+		}
+	}
+	rec := recs[0]
+	rec.File = pos.Filename
+	rec.Line = pos.Line
+	rec.Column = pos.Column
+	rec.Package = pass.Pkg.Path()
+	rec.Name = rep.name
+	rec.Type = typeName
+	rec.Fields, rec.OptimalFields = fieldOrders(results[0])
+	if fewestMoves && !sameOrder(results[0].optIdx) {
+		for _, j := range movedFields(results[0].optIdx) {
+			rec.MovedFields = append(rec.MovedFields, rec.Fields[j])
+		}
+	}
+	rec.Message = rep.diag.Message
+	rec.OrderSensitive = orderSiteStrings(pass.Fset, sites)
+	if len(recs) > 1 {
+		rec.Targets = recs
+	}
+	return rec
+}
+
+// fieldOrders returns the field names of the struct checked by r, in the current
+// and in the optimal order.
+func fieldOrders(r result) (current, optimal []string) {
+	current = make([]string, len(r.optIdx))
+	optimal = make([]string, len(r.optIdx))
+	for i, j := range r.optIdx {
+		name := r.optStruct.Field(i).Name()
+		optimal[i] = name
+		current[j] = name
+	}
+	return current, optimal
+}
+
+// typeSpecs returns the type specs declaring struct types.
+func typeSpecs(files []*ast.File) map[*ast.StructType]*ast.TypeSpec {
+	specs := make(map[*ast.StructType]*ast.TypeSpec)
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if ts, ok := n.(*ast.TypeSpec); ok {
+				if atyp, ok := astutil.Unparen(ts.Type).(*ast.StructType); ok {
+					specs[atyp] = ts
+				}
+			}
+			return true
+		})
+	}
+	return specs
+}
+
+// reporter writes the records of the analyzed packages to -output. Analyzers run
+// once per package, and there is no hook at the end of the analysis, so JSON records
+// are written to standard output as they come, one per line, while -output files
+// are rewritten after every package with all records so far, and the summary.
+// Records ranked with -heap-profile are only written to standard output as they
+// come when they cannot be deferred to the end of the run.
+type reporter struct {
+	mu      sync.Mutex
+	format  string
+	path    string
+	records []record
+	seen    map[string]bool // positions of records, test variants of packages repeat them
+}
+
+var structuredReport reporter
+
+func (rp *reporter) add(records []record) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	fresh := rp.format != outputFormat || rp.path != output
+	if fresh {
+		rp.format, rp.path, rp.records, rp.seen = outputFormat, output, nil, make(map[string]bool)
+	}
+	var added []record
+	for _, rec := range records {
+		pos := fmt.Sprintf("%s:%d:%d", rec.File, rec.Line, rec.Column)
+		if !rp.seen[pos] {
+			rp.seen[pos] = true
+			added = append(added, rec)
+		}
+	}
+	records = added
+	rp.records = append(rp.records, records...)
+
+	switch outputFormat {
+	case formatJSON:
+		if heapProfilePath != "" {
+			sortRecords(rp.records)
+		}
+		if output == "" {
+			// Ranked records are printed at the end of the run, when deferred.
+			if heapProfilePath != "" && os.Getenv(DeferredOutputEnv) != "" {
+				return nil
+			}
+			return writeJSONLines(os.Stdout, records)
+		}
+		var buf bytes.Buffer
+		if err := writeJSONLines(&buf, rp.records); err != nil {
+			return err
+		}
+		if sum := moduleSummary.current(); sum != nil {
+			if err := json.NewEncoder(&buf).Encode(summaryRecord{Summary: *sum}); err != nil {
+				return err
+			}
+		}
+		return os.WriteFile(output, buf.Bytes(), 0o644)
+	case formatSARIF:
+		if heapProfilePath != "" {
+			sortRecords(rp.records)
+		}
+		data, err := json.MarshalIndent(newSARIFLog(rp.records), "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(output, append(data, '\n'), 0o644)
+	}
+	return nil
+}
+
+// all returns the records written so far.
+func (rp *reporter) all() []record {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return append([]record(nil), rp.records...)
+}
+
+// sortRecords ranks records by the bytes estimated to be saved with -heap-profile.
+func sortRecords(records []record) {
+	sort.SliceStable(records, func(i, j int) bool { return records[i].HeapSavings > records[j].HeapSavings })
+}
+
+func writeJSONLines(w io.Writer, records []record) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFormat validates the -format and -output flags.
+func checkFormat() error {
+	switch outputFormat {
+	case formatText, formatJSON:
+		return nil
+	case formatSARIF:
+		if output == "" {
+			return fmt.Errorf("-format=%s requires -output", formatSARIF)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, want one of %s, %s or %s", outputFormat, formatText, formatJSON, formatSARIF)
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	Results    []sarifResult `json:"results"`
+	Properties *sarifSummary `json:"properties,omitempty"`
+}
+
+type sarifSummary struct {
+	Summary *summary `json:"summary"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations"`
+	Properties record          `json:"properties"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine   int `json:"startLine"`
+			StartColumn int `json:"startColumn"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+// newSARIFLog returns a SARIF 2.1.0 log of records.
+func newSARIFLog(records []record) sarifLog {
+	results := make([]sarifResult, len(records))
+	for i, rec := range records {
+		level := "note"
+		if rec.Sloppy {
+			level = "warning"
+		}
+		var loc sarifLocation
+		loc.PhysicalLocation.ArtifactLocation.URI = relPath(rec.File)
+		loc.PhysicalLocation.Region.StartLine = rec.Line
+		loc.PhysicalLocation.Region.StartColumn = rec.Column
+		if rec.Name != "" {
+			loc.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: rec.Name, Kind: "type"}}
+		}
+		results[i] = sarifResult{
+			RuleID:     categorySize,
+			Level:      level,
+			Message:    sarifMessage{Text: rec.Message},
+			Locations:  []sarifLocation{loc},
+			Properties: rec,
+		}
+	}
+	var props *sarifSummary
+	if sum := moduleSummary.current(); sum != nil {
+		props = &sarifSummary{Summary: sum}
+	}
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "structslop",
+				InformationURI: "https://github.com/orijtech/structslop",
+				Rules:          []sarifRule{{ID: categorySize, ShortDescription: sarifMessage{Text: Doc}}},
+			}},
+			Results:    results,
+			Properties: props,
+		}},
+	}
+}
+
+// relPath returns the path of filename relative to the working directory when
+// possible, with slashes, as SARIF consumers and diff headers expect.
+func relPath(filename string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, filename); err == nil && filepath.IsLocal(rel) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(filename)
+}
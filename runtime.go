@@ -14,7 +14,113 @@
 
 package structslop
 
-import _ "unsafe"
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
 
-//go:linkname roundUpSize runtime.roundupsize
-func roundUpSize(size uintptr) uintptr
+const (
+	maxSmallSize     = 32768
+	mallocHeaderSize = 8
+	pageSize         = 8192
+)
+
+//go:embed sizeclasses.txt
+var sizeClassesData string
+
+// sizeClasses describes the malloc size classes of a range of Go releases.
+type sizeClasses struct {
+	minor        int // first go1.minor release using these size classes
+	mallocHeader bool
+	sizes        []int64
+}
+
+var sizeClassesTables = mustParseSizeClasses(sizeClassesData)
+
+func mustParseSizeClasses(data string) []*sizeClasses {
+	var tables []*sizeClasses
+	var cur *sizeClasses
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "go") {
+			fields := strings.Fields(line)
+			minor, ok := parseGoMinor(fields[0])
+			if !ok {
+				panic(fmt.Sprintf("sizeclasses.txt:%d: invalid Go version %q", i+1, fields[0]))
+			}
+			cur = &sizeClasses{minor: minor, mallocHeader: len(fields) > 1 && fields[1] == "mallocheader"}
+			tables = append(tables, cur)
+			continue
+		}
+		if cur == nil || cur.sizes != nil {
+			panic(fmt.Sprintf("sizeclasses.txt:%d: unexpected size classes", i+1))
+		}
+		for _, f := range strings.Fields(line) {
+			n, err := strconv.ParseInt(f, 10, 64)
+			if err != nil {
+				panic(fmt.Sprintf("sizeclasses.txt:%d: %v", i+1, err))
+			}
+			cur.sizes = append(cur.sizes, n)
+		}
+	}
+	return tables
+}
+
+var goVersionRe = regexp.MustCompile(`^(?:go)?1\.(\d+)`)
+
+// parseGoMinor returns the minor version of a Go release like "go1.21.3" or "1.21".
+func parseGoMinor(version string) (int, bool) {
+	m := goVersionRe.FindStringSubmatch(version)
+	if m == nil {
+		return 0, false
+	}
+	minor, err := strconv.Atoi(m[1])
+	return minor, err == nil
+}
+
+// sizeClassesFor returns the size classes used by the given Go release. An empty
+// version means the release structslop was built with, or the latest known release
+// for development versions.
+func sizeClassesFor(version string) (*sizeClasses, error) {
+	if version == "" {
+		version = runtime.Version()
+		if _, ok := parseGoMinor(version); !ok {
+			return sizeClassesTables[len(sizeClassesTables)-1], nil
+		}
+	}
+	minor, ok := parseGoMinor(version)
+	if !ok {
+		return nil, fmt.Errorf("invalid Go version %q", version)
+	}
+	for i := len(sizeClassesTables) - 1; i >= 0; i-- {
+		if t := sizeClassesTables[i]; t.minor <= minor {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported Go version %q, size classes are known since go1.%d", version, sizeClassesTables[0].minor)
+}
+
+// roundUpSize returns the size of the memory block that mallocgc allocates for an
+// object of the given size, minus any malloc header, like runtime.roundupsize.
+func (c *sizeClasses) roundUpSize(size int64, noscan bool, ptrSize int64) int64 {
+	reqSize := size
+	if c.mallocHeader {
+		if reqSize <= maxSmallSize-mallocHeaderSize && !noscan && reqSize > ptrSize*ptrSize*8 {
+			reqSize += mallocHeaderSize
+		}
+	}
+	if reqSize <= maxSmallSize {
+		i := sort.Search(len(c.sizes), func(i int) bool { return c.sizes[i] >= reqSize })
+		return c.sizes[i] - (reqSize - size)
+	}
+	// Large objects are rounded up to the next page.
+	return (size + pageSize - 1) &^ (pageSize - 1)
+}
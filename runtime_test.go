@@ -0,0 +1,54 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import "testing"
+
+func TestRoundUpSize(t *testing.T) {
+	tests := []struct {
+		version string
+		size    int64
+		noscan  bool
+		want    int64
+	}{
+		{"1.15", 0, true, 0},
+		{"1.15", 1, true, 8},
+		{"1.15", 24, true, 32},
+		{"go1.16", 24, true, 24},
+		{"go1.21.3", 513, false, 576},
+		{"1.22", 512, false, 512},
+		{"1.22", 513, true, 576},
+		{"1.22", 513, false, 568},
+		{"1.22", 32768, true, 32768},
+		{"1.22", 32769, true, 40960},
+	}
+	for _, tt := range tests {
+		classes, err := sizeClassesFor(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := classes.roundUpSize(tt.size, tt.noscan, 8); got != tt.want {
+			t.Errorf("roundUpSize(%d, %v) for %s = %d, want %d", tt.size, tt.noscan, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestSizeClassesForInvalidVersion(t *testing.T) {
+	for _, version := range []string{"1.7", "2.0", "latest"} {
+		if _, err := sizeClassesFor(version); err == nil {
+			t.Errorf("sizeClassesFor(%q) succeeded, want error", version)
+		}
+	}
+}
@@ -93,12 +93,63 @@ func (s *sizes) Alignof(T types.Type) int64 {
 	return a
 }
 
+// ptrdata returns the size of the prefix of T which contains pointers, that is,
+// the number of bytes the garbage collector has to scan.
+func ptrdata(s types.Sizes, T types.Type) int64 {
+	ptrSize := s.Sizeof(types.Typ[types.UnsafePointer])
+	switch t := T.Underlying().(type) {
+	case *types.Basic:
+		if t.Kind() == types.String || t.Kind() == types.UnsafePointer {
+			return ptrSize
+		}
+		return 0
+	case *types.Array:
+		if t.Len() == 0 || !hasPointers(t.Elem()) {
+			return 0
+		}
+		return (t.Len()-1)*s.Sizeof(t.Elem()) + ptrdata(s, t.Elem())
+	case *types.Struct:
+		fields := structFields(t)
+		offsets := s.Offsetsof(fields)
+		var n int64
+		for i, f := range fields {
+			if p := ptrdata(s, f.Type()); p > 0 {
+				n = offsets[i] + p
+			}
+		}
+		return n
+	case *types.Interface:
+		return 2 * ptrSize
+	}
+	// Pointers, slices, maps, channels and functions start with a pointer.
+	return ptrSize
+}
+
 // align returns the smallest x >= subject such that x % target == 0.
 func align(subject, target int64) int64 {
 	x := subject + target - 1
 	return x - x%target
 }
 
+// hasPointers reports whether values of type T contain pointers.
+func hasPointers(T types.Type) bool {
+	switch t := T.Underlying().(type) {
+	case *types.Basic:
+		return t.Kind() == types.String || t.Kind() == types.UnsafePointer
+	case *types.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case *types.Struct:
+		for i, nf := 0, t.NumFields(); i < nf; i++ {
+			if hasPointers(t.Field(i).Type()) {
+				return true
+			}
+		}
+		return false
+	}
+	// Pointers, slices, maps, channels, functions and interfaces.
+	return true
+}
+
 func isComplex(typ types.Type) bool {
 	t, ok := typ.Underlying().(*types.Basic)
 	return ok && t.Info()&types.IsComplex != 0
@@ -32,29 +32,91 @@ import (
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/passes/inspect"
 	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
 )
 
 var (
 	includeTestFiles bool
 	verbose          bool
 	apply            bool
+	diffFixes        bool
 	generated        bool
+	compiler         = build.Default.Compiler
+	goarch           = build.Default.GOARCH
+	goVersion        string
+	gcPtrdata        bool
+	cacheLine        bool
+	cacheLineSize    int64 = 64
+	outputFormat           = formatText
+	output           string
+	showLayout       bool
+	baselinePath     string
+	writeBaseline    bool
+	skipOrder        bool
+	exactFields      = 16
+	fewestMoves      bool
+	keepGroups       bool
+	reorderGroups    bool
+	guarded          = true
+	heapProfilePath  string
+	minHeapSavings   int64 = 1
+	minBytes               = thresholdFlag{integer: true}
+	minPercent       thresholdFlag
+	minSize          = thresholdFlag{integer: true}
+	narrowTypes      bool
+	recursive        bool
+	summaryPath      string
 )
 
 func init() {
 	Analyzer.Flags.BoolVar(&includeTestFiles, "include-test-files", includeTestFiles, "also check test files")
 	Analyzer.Flags.BoolVar(&verbose, "verbose", verbose, "print all information, even when struct is not sloppy")
-	Analyzer.Flags.BoolVar(&apply, "apply", apply, "apply suggested fixes (using -fix won't work)")
+	Analyzer.Flags.BoolVar(&apply, "apply", apply, "apply suggested fixes, like -fix does")
+	Analyzer.Flags.BoolVar(&diffFixes, "print-diff", diffFixes, "print the unified diff of the changes -apply would make, and only report the structs it changes, so that the exit status is non-zero if there are any")
 	Analyzer.Flags.BoolVar(&generated, "generated", generated, "report issues in generated code")
+	Analyzer.Flags.StringVar(&compiler, "compiler", compiler, "compiler used to compute struct sizes")
+	Analyzer.Flags.StringVar(&goarch, "goarch", goarch, "comma separated list of architectures to compute struct sizes for, e.g. amd64,386,arm,wasm")
+	Analyzer.Flags.BoolVar(&gcPtrdata, "ptrdata", gcPtrdata, "order pointer fields first and report structs whose GC scanned bytes (ptrdata) can be reduced")
+	Analyzer.Flags.BoolVar(&cacheLine, "cacheline", cacheLine, "report contended fields sharing a cache line (false sharing)")
+	Analyzer.Flags.Int64Var(&cacheLineSize, "cacheline-size", cacheLineSize, "cache line size in bytes, used with -cacheline")
+	Analyzer.Flags.StringVar(&outputFormat, "format", outputFormat, "format of the struct records written to -output: text (none), json or sarif")
+	Analyzer.Flags.StringVar(&output, "output", output, "file to write struct records to, standard output if empty with -format=json")
+	Analyzer.Flags.BoolVar(&showLayout, "layout", showLayout, "print the offset, size, alignment and padding of fields of reported structs")
+	Analyzer.Flags.StringVar(&baselinePath, "baseline", baselinePath, "file of known sloppy structs, which are only reported if they get sloppier")
+	Analyzer.Flags.BoolVar(&writeBaseline, "write-baseline", writeBaseline, "write the sloppy structs to the -baseline file instead of reading it")
+	Analyzer.Flags.BoolVar(&skipOrder, "skip-order-sensitive", skipOrder, "do not report structs whose fields order is relied upon, instead of listing the code relying on it")
+	Analyzer.Flags.IntVar(&exactFields, "exact-fields", exactFields, "maximum number of fields of structs searched exhaustively for the order keeping pinned fields in place, or moving the fewest fields")
+	Analyzer.Flags.BoolVar(&fewestMoves, "minimal-moves", fewestMoves, "suggest the order reaching the optimal size class which moves the fewest fields")
+	Analyzer.Flags.BoolVar(&keepGroups, "keep-groups", keepGroups, "keep groups of fields separated by blank lines or comments together, only rearranging fields within groups")
+	Analyzer.Flags.BoolVar(&reorderGroups, "reorder-groups", reorderGroups, "also rearrange whole groups of fields, with -keep-groups")
+	Analyzer.Flags.BoolVar(&guarded, "guarded", guarded, "keep mutexes with the fields they guard, which follow them or are commented as guarded by them")
+	Analyzer.Flags.StringVar(&heapProfilePath, "heap-profile", heapProfilePath, "pprof heap profile used to estimate the bytes saved by rearranging structs, and rank reports by them")
+	Analyzer.Flags.Int64Var(&minHeapSavings, "min-heap-savings", minHeapSavings, "do not report structs estimated to save fewer bytes over the -heap-profile allocations")
+	Analyzer.Flags.Var(&minBytes, "min-bytes", "minimum bytes saved by the reported structs, may be given as pattern=value for the matching packages, the last match wins")
+	Analyzer.Flags.Var(&minPercent, "min-percent", "minimum percentage of the size saved by the reported structs, may be given as pattern=value for the matching packages")
+	Analyzer.Flags.Var(&minSize, "min-size", "minimum size of the reported structs, may be given as pattern=value for the matching packages")
+	Analyzer.Flags.BoolVar(&narrowTypes, "narrow", narrowTypes, "also suggest narrower field types: small integers only set to constants, bools packed in bit flags, and time.Time only used as timestamps")
+	Analyzer.Flags.BoolVar(&recursive, "recursive", recursive, "also rearrange the struct types nested in structs, and report the combined savings")
+	Analyzer.Flags.StringVar(&summaryPath, "summary", summaryPath, "file to write the number of checked and sloppy structs and the bytes they could save per package to, worst first, instead of printing them at the end of the run, as JSON with -format=json or sarif")
+	Analyzer.Flags.StringVar(&goVersion, "go-version", goVersion, "Go release whose malloc size classes are used, e.g. 1.21 (default: the release structslop is built with)")
 }
 
+// Diagnostic categories.
+const (
+	categorySize         = "size"
+	categoryAtomic       = "atomic-alignment"
+	categoryFalseSharing = "false-sharing"
+	categoryNarrow       = "narrow"
+	categoryOrder        = "order"
+)
+
 const Doc = `check for structs that can be rearrange fields to provide for maximum space/allocation efficiency`
 
 // Analyzer describes struct slop analysis function detector.
 var Analyzer = &analysis.Analyzer{
 	Name:     "structslop",
 	Doc:      Doc,
-	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Requires: []*analysis.Analyzer{inspect.Analyzer, orderAnalyzer, genericAnalyzer, layoutAnalyzer},
 	Run:      run,
 }
 
@@ -62,10 +124,37 @@ func run(pass *analysis.Pass) (interface{}, error) {
 	// Use custom sizes instance, which implements types.Sizes for calculating struct size.
 	// go/types and gc does not agree about the struct size.
 	// See https://github.com/golang/go/issues/14909#issuecomment-199936232
-	pass.TypesSizes = &sizes{
-		stdSizes: types.SizesFor(build.Default.Compiler, build.Default.GOARCH),
-		maxAlign: pass.TypesSizes.Alignof(types.Typ[types.UnsafePointer]),
+	if err := checkFormat(); err != nil {
+		return nil, err
+	}
+	if err := checkBaseline(); err != nil {
+		return nil, err
+	}
+	if err := checkHeapProfile(); err != nil {
+		return nil, err
+	}
+	if diffFixes {
+		if apply {
+			return nil, fmt.Errorf("-print-diff cannot be used with -apply")
+		}
+		// Only report the structs whose fix changes files, so that the exit status
+		// tells whether -apply would change any.
+		report := pass.Report
+		pass.Report = func(d analysis.Diagnostic) {
+			if len(d.SuggestedFixes) > 0 {
+				report(d)
+			}
+		}
+	}
+	classes, err := sizeClassesFor(goVersion)
+	if err != nil {
+		return nil, err
 	}
+	targets, err := parseTargets(compiler, goarch, classes)
+	if err != nil {
+		return nil, err
+	}
+	pass.TypesSizes = targets[0].sizes
 
 	dec := decorator.NewDecorator(pass.Fset)
 	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
@@ -74,9 +163,7 @@ func run(pass *analysis.Pass) (interface{}, error) {
 		(*ast.StructType)(nil),
 	}
 
-	fileDiags := make(map[string][]byte)
-	var af *ast.File
-	var df *dst.File
+	var reports []*report
 
 	// Track generated files unless -generated is set.
 	genFiles := make(map[*token.File]bool)
@@ -94,18 +181,93 @@ func run(pass *analysis.Pass) (interface{}, error) {
 			}
 		}
 	}
-	inspect.Preorder(nodeFilter, func(n ast.Node) {
+	ignored := ignoredTypes(pass.Files)
+	specs := typeSpecs(pass.Files)
+	names := structNames(pass.Pkg.Path(), pass.Files)
+	orderSensitive := pass.ResultOf[orderAnalyzer].(*orderSites)
+	generics := pass.ResultOf[genericAnalyzer].(*genericInstances)
+	layouts := pass.ResultOf[layoutAnalyzer].(*layoutFacts)
+	var uses fieldUses
+	if narrowTypes {
+		uses = narrowingUses(pass, inspect)
+	}
+	var allocs *typeutil.Map
+	if heapProfilePath != "" {
+		allocs = heapAllocations(pass)
+	}
+	var records []record
+	var entries []baselineEntry
+	checkedStructs := make(map[string]summaryEntry)
+	accessed := atomicFields(pass)
+	atomics := atomic64(accessed)
+	var contended contention
+	if cacheLine {
+		if cacheLineSize <= 0 {
+			return nil, fmt.Errorf("invalid cache line size: %d", cacheLineSize)
+		}
+		contended = contention{atomic: accessed, goroutines: goroutineFields(pass)}
+	}
+	skipped := func(n ast.Node) bool {
 		file := pass.Fset.File(n.Pos())
-		if strings.HasSuffix(file.Name(), "_test.go") && !includeTestFiles {
+		// Skip generated structs if instructed.
+		return strings.HasSuffix(file.Name(), "_test.go") && !includeTestFiles || !generated && genFiles[file]
+	}
+	var plans *nestedPlans
+	if recursive {
+		keep := func(atyp *ast.StructType) bool {
+			if skipped(atyp) || isIgnored(ignored, atyp) {
+				return true
+			}
+			styp, ok := pass.TypesInfo.Types[atyp].Type.(*types.Struct)
+			if !ok {
+				return true
+			}
+			_, T := declaredType(pass, specs[atyp], styp)
+			_, sites := splitOrderSites(styp, orderSensitive.lookup(T))
+			return len(sites) > 0
+		}
+		plans = newNestedPlans(pass, targets, specs, keep, func(atyp *ast.StructType, styp *types.Struct) constraints {
+			return structConstraints(pass.Fset, atyp, styp, atomics)
+		})
+	}
+	// dstStruct returns the dst node of atyp, decorating its file if needed, as
+	// nested structs may be declared in files not visited yet.
+	dstStruct := func(atyp *ast.StructType) (*dst.StructType, bool) {
+		if _, ok := dec.Dst.Nodes[atyp]; !ok {
+			for _, f := range pass.Files {
+				if _, ok := dec.Dst.Nodes[f]; !ok && f.Pos() <= atyp.Pos() && atyp.End() <= f.End() {
+					_, _ = dec.DecorateFile(f)
+				}
+			}
+		}
+		dtyp, ok := dec.Dst.Nodes[atyp].(*dst.StructType)
+		return dtyp, ok
+	}
+	// rearrange reorders the fields of atyp in the dst tree, once.
+	rearranged := make(map[*ast.StructType]bool)
+	rearrange := func(atyp *ast.StructType, dtyp *dst.StructType, styp *types.Struct, idx []int) {
+		if rearranged[atyp] {
 			return
 		}
-		// Skip generated structs if instructed.
-		if !generated && genFiles[file] {
+		rearranged[atyp] = true
+		c := structConstraints(pass.Fset, atyp, styp, atomics)
+		orig := append([]*dst.Field(nil), dtyp.Fields.List...)
+		reorderFields(dtyp, idx)
+		switch {
+		case keepGroups:
+			moveGroupHeaders(dtyp, orig, c.decls, c.groups, true)
+		case c.groups != nil:
+			moveGroupHeaders(dtyp, orig, c.decls, guardedSpacing(c.groups, c.heads, idx), false)
+		}
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		if skipped(n) {
 			return
 		}
 		if f, ok := n.(*ast.File); ok {
-			af = f
-			df, _ = dec.DecorateFile(af)
+			if _, ok := dec.Dst.Nodes[f]; !ok {
+				_, _ = dec.DecorateFile(f)
+			}
 			return
 		}
 		atyp := n.(*ast.StructType)
@@ -118,13 +280,127 @@ func run(pass *analysis.Pass) (interface{}, error) {
 			return
 		}
 
-		r := checkSloppy(pass, styp)
-		if !verbose && !r.sloppy() {
+		if isIgnored(ignored, atyp) {
 			return
 		}
+		// The layout of generic structs depends on their type arguments, so they
+		// are checked with the instantiations of the package, if any.
+		name := names[atyp]
+		generic := generics.lookup(pass, specs[atyp])
+		if generic == nil && layoutDependsOnTypeParams(styp) {
+			return
+		}
+		if generic == nil {
+			fieldIdx, offsets := misalignedAtomics(structFields(styp), atomics)
+			nodes := fieldNodes(atyp)
+			for i, idx := range fieldIdx {
+				pass.Report(analysis.Diagnostic{
+					Pos:      nodes[idx].Pos(),
+					Category: categoryAtomic,
+					Message:  fmt.Sprintf("%s: field %s is accessed atomically but is not 64-bit aligned on 32-bit platforms (offset %d)", name, styp.Field(idx).Name(), offsets[i]),
+				})
+			}
+			if cacheLine {
+				falseSharing(pass, targets[0].sizes, name, atyp, styp, contended, cacheLineSize)
+			}
+		}
+		c := structConstraints(pass.Fset, atyp, styp, atomics)
+		checked := targets
+		var results []result
+		var nested []*ast.StructType
+		var disagree []string
+		if generic != nil {
+			checked, results, disagree = generic.results(targets, c, qualifier(pass.Pkg.Path()))
+		} else if p := plans.plan(atyp); p != nil {
+			results, nested = p.results, plans.all(atyp)
+		} else {
+			results = checkTargets(targets, styp, c)
+		}
+		r := results[0]
+		sloppy := worthReporting(results, pass.Pkg.Path())
+		if summaryWanted() {
+			checkedStructs[pass.Fset.Position(n.Pos()).String()] = newSummaryEntry(pass.Pkg.Path(), r, sloppy)
+		}
+		if generic == nil && !sloppy && guarded && !keepGroups && c.groups != nil {
+			free := checkTargets(targets, styp, constraints{pinned: c.pinned, atomic: c.atomic, decls: c.decls})
+			if fr := free[0]; worthReporting(free, pass.Pkg.Path()) {
+				pass.Report(analysis.Diagnostic{
+					Pos:      n.Pos(),
+					End:      n.End(),
+					Category: categorySize,
+					Message: fmt.Sprintf(
+						"%s: struct has size %d (size class %d), could be %d (size class %d) only by moving fields away from the mutexes guarding them",
+						name, fr.oldGcSize, fr.oldRuntimeSize, fr.newGcSize, fr.newRuntimeSize,
+					),
+				})
+				return
+			}
+		}
+		typeName, T := declaredType(pass, specs[atyp], styp)
+		// Unkeyed literals of the struct are converted to keyed form by the fix, so
+		// only the other sites prevent rearranging the fields.
+		lits, sites := splitOrderSites(styp, orderSensitive.lookup(T))
+		if skipOrder && len(sites) > 0 {
+			return
+		}
+		// Narrower field types may save more than rearranging the fields. They
+		// would change the layout relied upon by order sensitive code, though.
+		var narrowMsg string
+		if narrowTypes && generic == nil && len(sites) == 0 {
+			if ns := narrowings(targets[0].sizes, pass.Pkg, styp, uses); len(ns) > 0 {
+				if nr := checkSloppy(targets[0], narrowedStruct(styp, ns), constraints{}); nr.newRuntimeSize < r.newRuntimeSize {
+					narrowMsg = strings.TrimSuffix(narrowMessage(styp, ns, qualifier(pass.Pkg.Path())), "\n")
+					if !sloppy {
+						pass.Report(analysis.Diagnostic{
+							Pos:      n.Pos(),
+							End:      n.End(),
+							Category: categoryNarrow,
+							Message: fmt.Sprintf(
+								"%s: struct has size %d (size class %d), could be %d (size class %d) with narrower field types:\n%s",
+								name, r.oldGcSize, r.oldRuntimeSize, nr.newGcSize, nr.newRuntimeSize, narrowMsg,
+							),
+						})
+						return
+					}
+					narrowMsg = fmt.Sprintf("with narrower field types, it could be %d (size class %d):\n%s", nr.newGcSize, nr.newRuntimeSize, narrowMsg)
+				}
+			}
+		}
+		if !verbose && !sloppy && len(disagree) == 0 {
+			return
+		}
+		// Sloppy struct types of other packages held by this one are noted too, as
+		// rearranging them in their package makes this one smaller.
+		importedFields, importedNotes := importedSloppyFields(pass, layouts, targets[0], styp)
+		var heap allocations
+		var heapSavings int64
+		if allocs != nil {
+			heap, _ = allocs.At(orderKey(T)).(allocations)
+			heapSavings = heap.savedBytes(r)
+			if sloppy && heapSavings < minHeapSavings {
+				return
+			}
+		}
+		if baselinePath != "" && sloppy {
+			entry := newBaselineEntry(pass.Pkg.Path(), typeName, r)
+			if writeBaseline {
+				entries = append(entries, entry)
+			} else if structsBaseline.known(entry) {
+				return
+			}
+		}
 
+		optStruct := r.optStruct
+		if generic != nil {
+			// Show the fields with their declared types.
+			fields := make([]*types.Var, len(r.optIdx))
+			for i, j := range r.optIdx {
+				fields[i] = styp.Field(j)
+			}
+			optStruct = types.NewStruct(fields, nil)
+		}
 		var buf bytes.Buffer
-		expr, err := parser.ParseExpr(formatStruct(r.optStruct, pass.Pkg.Path()))
+		expr, err := parser.ParseExpr(formatStruct(optStruct, pass.Pkg.Path()))
 		if err != nil {
 			return
 		}
@@ -132,107 +408,252 @@ func run(pass *analysis.Pass) (interface{}, error) {
 			return
 		}
 
-		var msg string
-		switch {
-		case r.oldGcSize == r.newGcSize:
-			msg = fmt.Sprintf("struct has size %d (size class %d)", r.oldGcSize, r.oldRuntimeSize)
-		case r.oldGcSize != r.newGcSize:
-			msg = fmt.Sprintf(
-				"struct has size %d (size class %d), could be %d (size class %d), optimal fields order:\n%s\n",
-				r.oldGcSize,
-				r.oldRuntimeSize,
-				r.newGcSize,
-				r.newRuntimeSize,
-				buf.String(),
-			)
-			if r.sloppy() {
-				msg = fmt.Sprintf(
-					"struct has size %d (size class %d), could be %d (size class %d), you'll save %.2f%% if you rearrange it to:\n%s\n",
-					r.oldGcSize,
-					r.oldRuntimeSize,
-					r.newGcSize,
-					r.newRuntimeSize,
-					r.savings(),
-					buf.String(),
-				)
+		msg := message(name, checked, results, sloppy, buf.String())
+		if fewestMoves && !sameOrder(r.optIdx) {
+			msg = strings.TrimSuffix(msg, "\n") + "\nmoved fields: " + strings.Join(fieldNames(styp, movedFields(r.optIdx)), ", ")
+		}
+		if len(nested) > 0 {
+			names := make([]string, len(nested))
+			for i, d := range nested {
+				names[i] = plans.names[d]
 			}
+			msg = strings.TrimSuffix(msg, "\n") + "\nwith nested structs rearranged: " + strings.Join(names, ", ")
 		}
-
-		dtyp := dec.Dst.Nodes[atyp].(*dst.StructType)
-		fields := make([]*dst.Field, 0, len(r.optIdx))
-		dummy := &dst.Field{}
-		for _, f := range dtyp.Fields.List {
-			fields = append(fields, f)
-			if len(f.Names) == 0 {
-				continue
+		if len(disagree) > 0 {
+			msg = strings.TrimSuffix(msg, "\n") + "\ninstantiations disagree on the optimal order, with their own:\n\t" + strings.Join(disagree, "\n\t")
+		}
+		if len(importedNotes) > 0 {
+			msg = strings.TrimSuffix(msg, "\n") + "\n" + strings.Join(importedNotes, "\n")
+		}
+		if narrowMsg != "" {
+			msg = strings.TrimSuffix(msg, "\n") + "\n" + narrowMsg
+		}
+		if allocs != nil {
+			msg = strings.TrimSuffix(msg, "\n") + fmt.Sprintf("\nestimated heap savings: %d bytes over %d allocations", heapSavings, heap.objects+heap.elements)
+		}
+		if showLayout {
+			if !strings.HasSuffix(msg, "\n") {
+				msg += "\n"
 			}
-			for range f.Names[1:] {
-				fields = append(fields, dummy)
+			lstyp := styp
+			if generic != nil {
+				lstyp = generic.instances[0].styp
 			}
+			msg += layoutMessage(targets[0].sizes, lstyp, r, qualifier(pass.Pkg.Path()))
 		}
-		optFields := make([]*dst.Field, 0, len(r.optIdx))
-		for _, i := range r.optIdx {
-			f := fields[i]
-			if f == dummy {
-				continue
-			}
-			optFields = append(optFields, f)
+		// Rearranging the fields would break the code relying on their order, so
+		// list it instead of suggesting a fix.
+		changed := !sameOrder(r.optIdx) || len(nested) > 0
+		if len(sites) > 0 && changed {
+			msg = strings.TrimSuffix(msg, "\n") + "\n" + orderMessage(pass.Fset, sites)
+			changed = false
 		}
-		dtyp.Fields.List = optFields
 
-		var suggested bytes.Buffer
-		if err := decorator.Fprint(&suggested, df); err != nil {
+		dtyp, ok := dstStruct(atyp)
+		if !ok {
 			return
 		}
-		pass.Report(analysis.Diagnostic{
-			Pos:            n.Pos(),
-			End:            n.End(),
-			Message:        msg,
-			SuggestedFixes: nil,
-		})
-		f := pass.Fset.File(n.Pos())
-		fileDiags[f.Name()] = suggested.Bytes()
+		// Nested structs declared elsewhere are rewritten by the fix too.
+		var nestedReports []*report
+		if changed {
+			rearrange(atyp, dtyp, styp, r.optIdx)
+			for _, d := range nested {
+				ddtyp, ok := dstStruct(d)
+				if !ok {
+					continue
+				}
+				if p := plans.plan(d); !sameOrder(p.results[0].optIdx) {
+					rearrange(d, ddtyp, pass.TypesInfo.Types[d].Type.(*types.Struct), p.results[0].optIdx)
+				}
+				if d.Pos() < atyp.Pos() || atyp.End() < d.End() {
+					nestedReports = append(nestedReports, &report{atyp: d, dtyp: ddtyp, changed: true})
+				}
+			}
+		}
+		rep := &report{
+			name:        name,
+			atyp:        atyp,
+			dtyp:        dtyp,
+			changed:     changed,
+			keyed:       keyedLiteralEdits(styp, lits),
+			heapSavings: heapSavings,
+			nested:      nestedReports,
+			diag: analysis.Diagnostic{
+				Pos:      n.Pos(),
+				End:      n.End(),
+				Category: categorySize,
+				Message:  msg,
+			},
+		}
+		reports = append(reports, rep)
+		if outputFormat != formatText {
+			rec := newRecord(pass, rep, typeName, checked, results, sites)
+			rec.ImportedSloppy = importedFields
+			if allocs != nil {
+				rec.HeapAllocations, rec.HeapSavings = heap.objects+heap.elements, heapSavings
+			}
+			records = append(records, rec)
+		}
 	})
-
-	if !apply {
-		return nil, nil
+	reportForeignInstances(pass, targets, generics, skipped)
+	if allocs != nil {
+		// Rank reports by the bytes they would save.
+		sort.SliceStable(reports, func(i, j int) bool { return reports[i].heapSavings > reports[j].heapSavings })
+		sortRecords(records)
 	}
-	for fn, content := range fileDiags {
-		fi, err := os.Open(fn)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "failed to open file: %v", err)
+	if summaryWanted() {
+		if err := moduleSummary.add(checkedStructs); err != nil {
+			return nil, err
 		}
-		st, err := fi.Stat()
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "failed to get file stat: %v", err)
+	}
+	if outputFormat != formatText {
+		if err := structuredReport.add(records); err != nil {
+			return nil, err
 		}
-		if err := fi.Close(); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "failed to close file: %v", err)
+	}
+	if err := writeDeferredOutput(); err != nil {
+		return nil, err
+	}
+	if writeBaseline {
+		if err := structsBaseline.add(entries); err != nil {
+			return nil, err
 		}
-		if err := os.WriteFile(fn, content, st.Mode()); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "failed to write suggested fix to file: %v", err)
+	}
+
+	// Sites relying on the fields order of sloppy types of other packages are
+	// reported here, as the packages of these types cannot see them.
+	orderDiags := importedOrderDiagnostics(pass, layouts, targets[0], orderSensitive)
+	diags := make([]analysis.Diagnostic, 0, len(reports)+len(orderDiags))
+	for _, d := range orderDiags {
+		pass.Report(d)
+		diags = append(diags, d)
+	}
+	for _, rep := range reports {
+		if rep.changed {
+			// A struct whose fix cannot be built is still reported.
+			if fix, err := suggestedFix(pass.Fset, pass.Files, rep); err == nil {
+				rep.diag.SuggestedFixes = []analysis.SuggestedFix{fix}
+			}
 		}
+		pass.Report(rep.diag)
+		diags = append(diags, rep.diag)
+	}
+
+	if diffFixes {
+		return nil, printFixes(pass.Fset, diags)
+	}
+	if !apply {
+		return nil, nil
+	}
+	if err := writeFixes(pass.Fset, diags); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
 	}
 	return nil, nil
 }
 
+// structConstraints returns the constraints on the order of the fields of atyp.
+func structConstraints(fset *token.FileSet, atyp *ast.StructType, styp *types.Struct, atomics map[*types.Var]bool) constraints {
+	c := constraints{pinned: pinnedFields(atyp), atomic: atomics, decls: fieldDecls(atyp)}
+	if keepGroups {
+		c.groups, c.regroup = fieldGroups(fset, atyp), reorderGroups
+		c.heads = groupMutexes(styp, c.groups)
+	} else if guarded {
+		c.groups, c.heads = guardedGroups(fset, atyp, styp)
+		c.regroup = true
+	}
+	return c
+}
+
+// declaredType returns the name and type declared by spec for styp, or styp
+// itself for anonymous structs.
+func declaredType(pass *analysis.Pass, spec *ast.TypeSpec, styp *types.Struct) (string, types.Type) {
+	if spec == nil {
+		return "", styp
+	}
+	if obj := pass.TypesInfo.Defs[spec.Name]; obj != nil {
+		return spec.Name.Name, obj.Type()
+	}
+	return spec.Name.Name, styp
+}
+
 type result struct {
 	oldGcSize      int64
 	newGcSize      int64
 	oldRuntimeSize int64
 	newRuntimeSize int64
+	oldPtrdata     int64 // only computed with -ptrdata
+	newPtrdata     int64
 	optStruct      *types.Struct
 	optIdx         []int
+	proven         bool // no order gives a smaller struct, or keeping pinned fields in place
 }
 
 func (r result) sloppy() bool {
-	return r.oldRuntimeSize > r.newRuntimeSize
+	return r.oldRuntimeSize > r.newRuntimeSize || r.oldPtrdata > r.newPtrdata
+}
+
+// changed reports whether the struct layout would change with the optimal order.
+func (r result) changed() bool {
+	return r.oldGcSize != r.newGcSize || r.oldPtrdata != r.newPtrdata
 }
 
 func (r result) savings() float64 {
 	return float64(r.oldRuntimeSize-r.newRuntimeSize) / float64(r.oldRuntimeSize) * 100
 }
 
+// sizeMessage describes the current and optimal sizes of a struct.
+func sizeMessage(r result) string {
+	msg := fmt.Sprintf("struct has size %d (size class %d)", r.oldGcSize, r.oldRuntimeSize)
+	if r.oldGcSize != r.newGcSize {
+		msg += fmt.Sprintf(", could be %d (size class %d)", r.newGcSize, r.newRuntimeSize)
+		if r.oldRuntimeSize > r.newRuntimeSize {
+			msg += fmt.Sprintf(", you'll save %.2f%%", r.savings())
+		}
+	}
+	if r.oldPtrdata > 0 {
+		msg += fmt.Sprintf(", GC scans %d bytes", r.oldPtrdata)
+		if r.oldPtrdata != r.newPtrdata {
+			msg += fmt.Sprintf(", could scan %d", r.newPtrdata)
+		}
+	}
+	return msg
+}
+
+// message builds the diagnostic message for the results of checkTargets. With many
+// targets, or instantiations of a generic struct, the sizes on each of them are listed,
+// followed by the arrangement suggested for all of them.
+func message(name string, targets []target, results []result, sloppy bool, optStruct string) string {
+	if len(targets) == 1 && targets[0].label == "" {
+		r := results[0]
+		msg := name + ": " + sizeMessage(r)
+		switch {
+		case !r.changed():
+			return msg
+		case sloppy:
+			return fmt.Sprintf("%s if you rearrange it to:\n%s\n", msg, optStruct)
+		default:
+			return fmt.Sprintf("%s, optimal fields order:\n%s\n", msg, optStruct)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:\n", name)
+	changed := false
+	for i, t := range targets {
+		fmt.Fprintf(&b, "%s: %s\n", t.name(), sizeMessage(results[i]))
+		changed = changed || results[i].changed()
+	}
+	switch {
+	case !changed:
+		return strings.TrimSuffix(b.String(), "\n")
+	case sloppy:
+		fmt.Fprintf(&b, "rearrange it to:\n%s\n", optStruct)
+	default:
+		fmt.Fprintf(&b, "optimal fields order:\n%s\n", optStruct)
+	}
+	return b.String()
+}
+
 func mapFieldIdx(s *types.Struct) map[*types.Var]int {
 	m := make(map[*types.Var]int, s.NumFields())
 	for i := 0; i < s.NumFields(); i++ {
@@ -241,21 +662,93 @@ func mapFieldIdx(s *types.Struct) map[*types.Var]int {
 	return m
 }
 
-func checkSloppy(pass *analysis.Pass, origStruct *types.Struct) result {
+// constraints restricts how the fields of a struct can be rearranged.
+type constraints struct {
+	pinned  []bool              // fields which must keep their position
+	atomic  map[*types.Var]bool // fields which must stay 64-bit aligned on 32-bit platforms
+	decls   []int               // declaration of every field, for -minimal-moves
+	groups  []int               // group of every field, which is kept together
+	heads   []bool              // fields which stay first in their group
+	regroup bool                // whether groups can be rearranged
+}
+
+func (c constraints) hasPins() bool {
+	for _, p := range c.pinned {
+		if p {
+			return true
+		}
+	}
+	return false
+}
+
+func checkSloppy(t target, origStruct *types.Struct, c constraints) result {
 	m := mapFieldIdx(origStruct)
-	optStruct := optimalStructArrangement(pass.TypesSizes, m)
+	var optStruct *types.Struct
+	proven := false // by the exact search, for pinned fields
+	switch {
+	case c.groups != nil:
+		optStruct = groupedStructArrangement(t.sizes, origStruct, c.groups, c.heads, c.regroup)
+		for i, p := range c.pinned {
+			if p && optStruct.Field(i) != origStruct.Field(i) {
+				optStruct = origStruct
+				break
+			}
+		}
+	case c.hasPins():
+		optStruct = pinnedStructArrangement(t.sizes, m, c.pinned)
+		// Filling the positions around pinned fields in sorted order may leave
+		// holes, so search exactly when the result is not optimal anyway.
+		if !provenOptimal(t, origStruct, t.sizes.Sizeof(optStruct)) {
+			if exact, ok := exactStructArrangement(t.sizes, origStruct, c.pinned); ok {
+				if t.sizes.Sizeof(exact) < t.sizes.Sizeof(optStruct) {
+					optStruct = exact
+				}
+				proven = true
+			}
+		}
+	default:
+		// Sorting gives no padding between fields, as sizes are multiples of
+		// alignments, so it is optimal.
+		optStruct = optimalStructArrangement(t.sizes, m)
+	}
+	// Never suggest an order misaligning fields accessed atomically. Move them first,
+	// or keep the current order if pinned fields or groups prevent it.
+	if idx, _ := misalignedAtomics(structFields(optStruct), c.atomic); len(idx) > 0 {
+		proven = false
+		if c.hasPins() || c.groups != nil {
+			optStruct = origStruct
+		} else {
+			optStruct = atomicFirst(t.sizes, optStruct, c.atomic)
+		}
+	}
 	idx := make([]int, optStruct.NumFields())
 	for i := range idx {
 		idx[i] = m[optStruct.Field(i)]
 	}
+	r := arrange(t, origStruct, idx)
+	r.proven = proven || provenOptimal(t, origStruct, r.newGcSize)
+	return r
+}
+
+// arrange computes the result of rearranging origStruct fields to the given order.
+func arrange(t target, origStruct *types.Struct, idx []int) result {
+	fields := make([]*types.Var, len(idx))
+	for i, j := range idx {
+		fields[i] = origStruct.Field(j)
+	}
+	optStruct := types.NewStruct(fields, nil)
 	r := result{
-		oldGcSize: pass.TypesSizes.Sizeof(origStruct),
-		newGcSize: pass.TypesSizes.Sizeof(optStruct),
-		optStruct: optStruct,
-		optIdx:    idx,
+		oldGcSize:      t.sizes.Sizeof(origStruct),
+		newGcSize:      t.sizes.Sizeof(optStruct),
+		oldRuntimeSize: t.runtimeSize(origStruct),
+		newRuntimeSize: t.runtimeSize(optStruct),
+		optStruct:      optStruct,
+		optIdx:         idx,
+	}
+	if gcPtrdata {
+		r.oldPtrdata = ptrdata(t.sizes, origStruct)
+		r.newPtrdata = ptrdata(t.sizes, optStruct)
 	}
-	r.oldRuntimeSize = int64(roundUpSize(uintptr(r.oldGcSize)))
-	r.newRuntimeSize = int64(roundUpSize(uintptr(r.newGcSize)))
 	return r
 }
 
@@ -281,6 +774,22 @@ func optimalStructArrangement(sizes types.Sizes, m map[*types.Var]int) *types.St
 			return ai > aj
 		}
 
+		// Fields with the same alignment can be swapped without adding padding, so
+		// move pointers first, ending with the largest pointer-free tail, to keep
+		// the part of the struct scanned by the GC short.
+		if gcPtrdata {
+			pi, pj := hasPointers(ti), hasPointers(tj)
+			if pi != pj {
+				return pi
+			}
+			if pi {
+				tailI, tailJ := si-ptrdata(sizes, ti), sj-ptrdata(sizes, tj)
+				if tailI != tailJ {
+					return tailI < tailJ
+				}
+			}
+		}
+
 		if si != sj {
 			return si > sj
 		}
@@ -292,11 +801,15 @@ func optimalStructArrangement(sizes types.Sizes, m map[*types.Var]int) *types.St
 }
 
 func formatStruct(styp *types.Struct, curPkgPath string) string {
-	qualifier := func(p *types.Package) string {
+	return types.TypeString(styp, qualifier(curPkgPath))
+}
+
+// qualifier qualifies types by their package name, except for the current package.
+func qualifier(curPkgPath string) types.Qualifier {
+	return func(p *types.Package) string {
 		if p.Path() == curPkgPath {
 			return ""
 		}
 		return p.Name()
 	}
-	return types.TypeString(styp, qualifier)
 }
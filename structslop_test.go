@@ -16,6 +16,10 @@ package structslop_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -56,6 +60,47 @@ func TestApply(t *testing.T) {
 	}
 }
 
+// TestApplyTestVariant checks that -apply rewrites a package with test files once,
+// although its test variant is analyzed too.
+func TestApplyTestVariant(t *testing.T) {
+	dir := strings.Join([]string{".", "testdata", "src"}, string(os.PathSeparator))
+	tmpdir, err := os.MkdirTemp(dir, "structslop-test-apply-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	fn := filepath.Join(tmpdir, "p.go")
+	src, _ := os.ReadFile(filepath.Join(".", "testdata", "src", "keyed", "p.go"))
+	if err := os.WriteFile(fn, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	test := []byte("package p\n\nimport \"testing\"\n\nfunc TestS(t *testing.T) { _ = s{} }\n")
+	if err := os.WriteFile(filepath.Join(tmpdir, "p_test.go"), test, 0644); err != nil {
+		t.Fatal(err)
+	}
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("apply", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("apply", "false")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, filepath.Base(tmpdir))
+	got, _ := os.ReadFile(fn)
+	expected, _ := os.ReadFile(filepath.Join(".", "testdata", "src", "keyed", "p.go.golden"))
+	if !bytes.Equal(expected, got) {
+		t.Errorf("unexpected suggested fix, want:\n%s\ngot:\n%s\n", string(expected), string(got))
+	}
+}
+
+func TestSuggestedFixes(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.RunWithSuggestedFixes(t, testdata, structslop.Analyzer, "struct")
+}
+
+func TestKeyedLiterals(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.RunWithSuggestedFixes(t, testdata, structslop.Analyzer, "keyed")
+}
+
 func TestIncludeTestFiles(t *testing.T) {
 	testdata := analysistest.TestData()
 	_ = structslop.Analyzer.Flags.Set("include-test-files", "true")
@@ -74,7 +119,502 @@ func TestVerboseMode(t *testing.T) {
 	analysistest.Run(t, testdata, structslop.Analyzer, "verbose")
 }
 
+func TestGoarch(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("goarch", "amd64,386")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("goarch", build.Default.GOARCH)
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "goarch")
+}
+
+func TestGoVersion(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("go-version", "1.15")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("go-version", "")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "goversion")
+}
+
+func TestPtrdata(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("ptrdata", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("ptrdata", "false")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "ptrdata")
+}
+
+func TestMinimalMoves(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("minimal-moves", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("minimal-moves", "false")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "moves")
+}
+
+func TestKeepGroups(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("keep-groups", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("keep-groups", "false")
+	}()
+	analysistest.RunWithSuggestedFixes(t, testdata, structslop.Analyzer, "groups")
+}
+
+func TestReorderGroups(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("keep-groups", "true")
+	_ = structslop.Analyzer.Flags.Set("reorder-groups", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("keep-groups", "false")
+		_ = structslop.Analyzer.Flags.Set("reorder-groups", "false")
+	}()
+	analysistest.RunWithSuggestedFixes(t, testdata, structslop.Analyzer, "reordergroups")
+}
+
+func TestGuarded(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.RunWithSuggestedFixes(t, testdata, structslop.Analyzer, "guarded")
+}
+
+func TestThresholds(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("min-bytes", "16")
+	_ = structslop.Analyzer.Flags.Set("min-size", "thresholds/...=48")
+	_ = structslop.Analyzer.Flags.Set("min-percent", "other/...=90")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("min-bytes", "")
+		_ = structslop.Analyzer.Flags.Set("min-size", "")
+		_ = structslop.Analyzer.Flags.Set("min-percent", "")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "thresholds")
+}
+
+func TestNarrow(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("narrow", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("narrow", "false")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "narrow")
+}
+
+func TestRecursive(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("recursive", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("recursive", "false")
+	}()
+	analysistest.RunWithSuggestedFixes(t, testdata, structslop.Analyzer, "recursive")
+}
+
+func TestGenerics(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, structslop.Analyzer, "generic", "generic/user")
+}
+
+func TestNames(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, structslop.Analyzer, "names")
+}
+
+func TestImportedFacts(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, structslop.Analyzer, "facts")
+}
+
+func TestImportedOrderSensitive(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.RunWithSuggestedFixes(t, testdata, structslop.Analyzer, "importer")
+	analysistest.Run(t, testdata, structslop.Analyzer, "xtest")
+}
+
+func TestDirectives(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, structslop.Analyzer, "directive")
+}
+
+func TestOrderSensitive(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, structslop.Analyzer, "order")
+}
+
+func TestSkipOrderSensitive(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("skip-order-sensitive", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("skip-order-sensitive", "false")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "order/skip")
+}
+
+func TestAtomic(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, structslop.Analyzer, "atomic")
+}
+
+func TestCacheLine(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("cacheline", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("cacheline", "false")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "cacheline")
+}
+
+func TestJSONFormat(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "structslop.json")
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("format", "json")
+	_ = structslop.Analyzer.Flags.Set("output", out)
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("format", "text")
+		_ = structslop.Analyzer.Flags.Set("output", "")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "include-test-files")
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec struct {
+		Name             string
+		Type             string
+		Size             int64
+		SizeClass        int64 `json:"size_class"`
+		OptimalSize      int64 `json:"optimal_size"`
+		OptimalSizeClass int64 `json:"optimal_size_class"`
+		Savings          float64
+		Fields           []string
+		OptimalFields    []string `json:"optimal_fields"`
+		ProvenOptimal    bool     `json:"proven_optimal"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	// The records end with the summary.
+	var sum struct {
+		Summary struct {
+			Total struct {
+				Structs int
+				Sloppy  int
+			}
+		}
+	}
+	if err := dec.Decode(&sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum.Summary.Total.Structs != 1 || sum.Summary.Total.Sloppy != 1 || dec.More() {
+		t.Errorf("unexpected summary record: %+v", sum)
+	}
+	if rec.Name != "include-test-files.s" || rec.Type != "s" || rec.Size != 24 || rec.SizeClass != 24 || rec.OptimalSize != 16 || rec.OptimalSizeClass != 16 {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	if got := strings.Join(rec.Fields, ","); got != "x,y,z" {
+		t.Errorf("unexpected fields: %s", got)
+	}
+	if got := strings.Join(rec.OptimalFields, ","); got != "y,x,z" {
+		t.Errorf("unexpected optimal fields: %s", got)
+	}
+	if rec.Savings < 33.3 || rec.Savings > 33.4 {
+		t.Errorf("unexpected savings: %f", rec.Savings)
+	}
+	if !rec.ProvenOptimal {
+		t.Error("optimal order is not proven")
+	}
+}
+
+func TestSARIFFormat(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "structslop.sarif")
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("format", "sarif")
+	_ = structslop.Analyzer.Flags.Set("output", out)
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("format", "text")
+		_ = structslop.Analyzer.Flags.Set("output", "")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "struct")
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				RuleID string
+				Level  string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected SARIF log: %s", data)
+	}
+	if n := len(log.Runs[0].Results); n != 8 {
+		t.Errorf("got %d results, want 8", n)
+	}
+	for _, r := range log.Runs[0].Results {
+		if r.RuleID != "size" || r.Level != "warning" {
+			t.Errorf("unexpected result: %+v", r)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("print-diff", "true")
+	defer func() {
+		os.Stdout = stdout
+		_ = structslop.Analyzer.Flags.Set("print-diff", "false")
+	}()
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- data
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "include-test-files")
+	_ = w.Close()
+
+	want := `--- a/testdata/src/include-test-files/p.go
++++ b/testdata/src/include-test-files/p.go
+@@ -15,7 +15,7 @@
+ package p
+ 
+ type s struct { // want ` + "`" + `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to:\nstruct {\n\ty uint64\n\tx uint32\n\tz uint32\n}` + "`" + `
+-	x uint32
+ 	y uint64
++	x uint32
+ 	z uint32
+ }
+`
+	if got := string(<-out); got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "summary.txt")
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("summary", out)
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("summary", "")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "include-test-files", "directive")
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Packages saving the most bytes come first.
+	want := `package             structs  sloppy  size  savings  percent
+directive           3        2       96    24       25.00%
+include-test-files  1        1       24    8        33.33%
+total               4        3       120   32       26.67%
+`
+	if string(data) != want {
+		t.Errorf("unexpected summary:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestDeferredSummary(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "deferred")
+	t.Setenv(structslop.DeferredOutputEnv, out)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, structslop.Analyzer, "include-test-files")
+
+	// Without -summary, the summary is printed at the end of the run.
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package             structs  sloppy  size  savings  percent
+include-test-files  1        1       24    8        33.33%
+total               1        1       24    8        33.33%
+`
+	if string(data) != want {
+		t.Errorf("unexpected deferred output:\n%s\nwant:\n%s", data, want)
+	}
+
+	// JSON records written to standard output end with the summary.
+	_ = structslop.Analyzer.Flags.Set("format", "json")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("format", "text")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "include-test-files")
+	if data, err = os.ReadFile(out); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"summary":{"packages":[{"package":"include-test-files","structs":1,"sloppy":1,"size":24,"savings":8,"percent":33.33333333333333}],"total":{"package":"total","structs":1,"sloppy":1,"size":24,"savings":8,"percent":33.33333333333333}}}` + "\n"; string(data) != want {
+		t.Errorf("unexpected deferred output:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "summary.json")
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("summary", out)
+	_ = structslop.Analyzer.Flags.Set("format", "json")
+	_ = structslop.Analyzer.Flags.Set("output", filepath.Join(dir, "structslop.json"))
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("summary", "")
+		_ = structslop.Analyzer.Flags.Set("format", "text")
+		_ = structslop.Analyzer.Flags.Set("output", "")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "struct")
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum struct {
+		Packages []struct {
+			Package string
+			Structs int
+			Sloppy  int
+			Savings int64
+		}
+		Total struct {
+			Structs int
+			Sloppy  int
+			Savings int64
+		}
+	}
+	if err := json.Unmarshal(data, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.Packages) != 1 || sum.Packages[0].Package != "struct" {
+		t.Fatalf("unexpected summary: %s", data)
+	}
+	if p := sum.Packages[0]; p.Structs != sum.Total.Structs || p.Sloppy != 8 || p.Savings != sum.Total.Savings {
+		t.Errorf("unexpected summary: %s", data)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("layout", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("layout", "false")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "layout")
+}
+
+func TestBaseline(t *testing.T) {
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("baseline", filepath.Join(testdata, "src", "baseline", "baseline.json"))
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("baseline", "")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "baseline")
+}
+
+func TestWriteBaseline(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "baseline.json")
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("baseline", out)
+	_ = structslop.Analyzer.Flags.Set("write-baseline", "true")
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("baseline", "")
+		_ = structslop.Analyzer.Flags.Set("write-baseline", "false")
+	}()
+	analysistest.Run(t, testdata, structslop.Analyzer, "include-test-files")
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "structs": [
+    {
+      "package": "include-test-files",
+      "type": "s",
+      "fields": [
+        "x uint32",
+        "y uint64",
+        "z uint32"
+      ],
+      "size_class": 24,
+      "optimal_size_class": 16
+    }
+  ]
+}
+`
+	if string(got) != want {
+		t.Errorf("unexpected baseline, want:\n%s\ngot:\n%s\n", want, got)
+	}
+}
+
 func TestGenerated(t *testing.T) {
 	testdata := analysistest.TestData()
 	analysistest.Run(t, testdata, structslop.Analyzer, "generated")
 }
+
+func TestHeapProfile(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "structslop.json")
+	testdata := analysistest.TestData()
+	_ = structslop.Analyzer.Flags.Set("heap-profile", filepath.Join(testdata, "src", "heap", "heap.pb.gz"))
+	_ = structslop.Analyzer.Flags.Set("min-heap-savings", "100")
+	_ = structslop.Analyzer.Flags.Set("format", "json")
+	_ = structslop.Analyzer.Flags.Set("output", out)
+	defer func() {
+		_ = structslop.Analyzer.Flags.Set("heap-profile", "")
+		_ = structslop.Analyzer.Flags.Set("min-heap-savings", "1")
+		_ = structslop.Analyzer.Flags.Set("format", "text")
+		_ = structslop.Analyzer.Flags.Set("output", "")
+	}()
+	// Records are ranked by the bytes they save.
+	ranked := func(path string) string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for dec.More() {
+			var rec struct {
+				Type            string
+				HeapAllocations int64 `json:"heap_allocations"`
+				HeapSavings     int64 `json:"heap_savings"`
+				Summary         json.RawMessage
+			}
+			if err := dec.Decode(&rec); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Summary != nil {
+				continue
+			}
+			got = append(got, fmt.Sprintf("%s:%d:%d", rec.Type, rec.HeapAllocations, rec.HeapSavings))
+		}
+		return strings.Join(got, ",")
+	}
+	const want = "hot:1000:8000,elem:100:800"
+	analysistest.Run(t, testdata, structslop.Analyzer, "heap")
+	if got := ranked(out); got != want {
+		t.Errorf("unexpected records: %s, want %s", got, want)
+	}
+
+	// Records for standard output are ranked at the end of the run.
+	deferred := filepath.Join(t.TempDir(), "deferred")
+	t.Setenv(structslop.DeferredOutputEnv, deferred)
+	_ = structslop.Analyzer.Flags.Set("output", "")
+	analysistest.Run(t, testdata, structslop.Analyzer, "heap")
+	if got := ranked(deferred); got != want {
+		t.Errorf("unexpected deferred records: %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// summarizer aggregates the checked structs of the analyzed packages, and writes
+// their totals to -summary. There is no hook at the end of the analysis, so the
+// summary is rewritten after every package, like SARIF logs. Without -summary, it
+// ends JSON records, or is printed at the end of the run by cmd/structslop.
+type summarizer struct {
+	mu      sync.Mutex
+	run     string                  // flags the structs were recorded with
+	structs map[string]summaryEntry // by position, test variants of packages repeat them
+}
+
+// summaryEntry is a checked struct, with its sizes on the first target.
+type summaryEntry struct {
+	pkg       string
+	sizeClass int64
+	saved     int64 // size class bytes saved by rearranging it, if sloppy
+	sloppy    bool
+}
+
+var moduleSummary summarizer
+
+// packageSummary holds the totals of the structs of a package.
+type packageSummary struct {
+	Package string  `json:"package"`
+	Structs int     `json:"structs"`
+	Sloppy  int     `json:"sloppy"`
+	Size    int64   `json:"size"`    // sum of the size classes of the structs
+	Savings int64   `json:"savings"` // bytes saved by rearranging the sloppy structs
+	Percent float64 `json:"percent"`
+}
+
+// summary holds the totals of every package, worst first, and of all of them.
+type summary struct {
+	Packages []packageSummary `json:"packages"`
+	Total    packageSummary   `json:"total"`
+}
+
+// newSummaryEntry returns the summary entry of a struct checked with results r.
+func newSummaryEntry(pkg string, r result, sloppy bool) summaryEntry {
+	e := summaryEntry{pkg: pkg, sizeClass: r.oldRuntimeSize, sloppy: sloppy}
+	if sloppy && r.oldRuntimeSize > r.newRuntimeSize {
+		e.saved = r.oldRuntimeSize - r.newRuntimeSize
+	}
+	return e
+}
+
+// summaryRecord is the last JSON record, holding the summary of the structs of the
+// records before it.
+type summaryRecord struct {
+	Summary summary `json:"summary"`
+}
+
+// summaryWanted reports whether the summary of the checked structs is written
+// anywhere: to -summary, with structured records, or at the end of the run.
+func summaryWanted() bool {
+	return summaryPath != "" || outputFormat != formatText || os.Getenv(DeferredOutputEnv) != ""
+}
+
+// add records the checked structs of a package, and rewrites the summary.
+func (s *summarizer) add(structs map[string]summaryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := strings.Join([]string{summaryPath, outputFormat, output}, "\x00")
+	if s.run != run || s.structs == nil {
+		s.run, s.structs = run, make(map[string]summaryEntry)
+	}
+	for pos, e := range structs {
+		s.structs[pos] = e
+	}
+	if summaryPath == "" {
+		return nil
+	}
+	sum := s.summary()
+
+	var data []byte
+	if outputFormat == formatText {
+		data = []byte(sum.String())
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(sum, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	return os.WriteFile(summaryPath, data, 0o644)
+}
+
+// current returns the summary so far, if it is wanted.
+func (s *summarizer) current() *summary {
+	if !summaryWanted() {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := s.summary()
+	return &sum
+}
+
+// summary returns the totals of the recorded structs.
+func (s *summarizer) summary() summary {
+	byPkg := make(map[string]*packageSummary)
+	sum := summary{Total: packageSummary{Package: "total"}}
+	for _, e := range s.structs {
+		p := byPkg[e.pkg]
+		if p == nil {
+			p = &packageSummary{Package: e.pkg}
+			byPkg[e.pkg] = p
+		}
+		for _, t := range []*packageSummary{p, &sum.Total} {
+			t.Structs++
+			t.Size += e.sizeClass
+			t.Savings += e.saved
+			if e.sloppy {
+				t.Sloppy++
+			}
+		}
+	}
+	for _, p := range byPkg {
+		p.Percent = percent(p.Savings, p.Size)
+		sum.Packages = append(sum.Packages, *p)
+	}
+	sum.Total.Percent = percent(sum.Total.Savings, sum.Total.Size)
+	sort.Slice(sum.Packages, func(i, j int) bool {
+		pi, pj := sum.Packages[i], sum.Packages[j]
+		if pi.Savings != pj.Savings {
+			return pi.Savings > pj.Savings
+		}
+		if pi.Percent != pj.Percent {
+			return pi.Percent > pj.Percent
+		}
+		return pi.Package < pj.Package
+	})
+	return sum
+}
+
+func percent(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
+
+// String returns the summary as a table, followed by the totals.
+func (sum summary) String() string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "package\tstructs\tsloppy\tsize\tsavings\tpercent")
+	for _, p := range append(sum.Packages, sum.Total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.2f%%\n", p.Package, p.Structs, p.Sloppy, p.Size, p.Savings, p.Percent)
+	}
+	_ = tw.Flush()
+	return b.String()
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// target is a compiler/architecture pair that struct layouts are computed for.
+type target struct {
+	goarch  string
+	sizes   *sizes
+	classes *sizeClasses
+
+	instance string // instantiation of the generic struct checked on the target
+	label    string // name of the target in messages, goarch if empty
+}
+
+// name returns the name of the target in messages.
+func (t target) name() string {
+	if t.label != "" {
+		return t.label
+	}
+	return t.goarch
+}
+
+// runtimeSize returns the size class of T on the target.
+func (t target) runtimeSize(T types.Type) int64 {
+	ptrSize := t.sizes.Sizeof(types.Typ[types.UnsafePointer])
+	return t.classes.roundUpSize(t.sizes.Sizeof(T), !hasPointers(T), ptrSize)
+}
+
+// parseTargets returns the targets for the comma separated list of GOARCH values.
+func parseTargets(compiler, goarchs string, classes *sizeClasses) ([]target, error) {
+	var targets []target
+	seen := make(map[string]bool)
+	for _, goarch := range strings.Split(goarchs, ",") {
+		goarch = strings.TrimSpace(goarch)
+		if goarch == "" || seen[goarch] {
+			continue
+		}
+		seen[goarch] = true
+		stdSizes := types.SizesFor(compiler, goarch)
+		if stdSizes == nil {
+			return nil, fmt.Errorf("unsupported compiler/architecture pair: %s/%s", compiler, goarch)
+		}
+		targets = append(targets, target{
+			goarch: goarch,
+			sizes: &sizes{
+				stdSizes: stdSizes,
+				maxAlign: stdSizes.Alignof(types.Typ[types.UnsafePointer]),
+			},
+			classes: classes,
+		})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no target architecture given")
+	}
+	return targets, nil
+}
+
+// checkTargets runs checkSloppy for every target. When there are many targets, the
+// suggested order is the one which gives the smallest total size class across all
+// of them, so a single arrangement is reported for every target.
+func checkTargets(targets []target, styp *types.Struct, c constraints) []result {
+	results := make([]result, len(targets))
+	for i, t := range targets {
+		results[i] = checkSloppy(t, styp, c)
+	}
+	if len(targets) > 1 {
+		idx := bestOrder(targets, styp, results)
+		for i, t := range targets {
+			results[i] = arrange(t, styp, idx)
+			results[i].proven = provenOptimal(t, styp, results[i].newGcSize)
+		}
+	}
+	if fewestMoves && anySloppy(results) {
+		if idx, ok := minimalMoves(targets, styp, c, results); ok {
+			for i, t := range targets {
+				results[i] = arrange(t, styp, idx)
+				results[i].proven = provenOptimal(t, styp, results[i].newGcSize)
+			}
+		}
+	}
+	return results
+}
+
+// anySloppy reports whether the struct is sloppy on any target.
+func anySloppy(results []result) bool {
+	for _, r := range results {
+		if r.sloppy() {
+			return true
+		}
+	}
+	return false
+}
+
+// bestOrder returns the fields order of results which is best across all targets.
+func bestOrder(targets []target, styp *types.Struct, results []result) []int {
+
+	best := 0
+	var bestRuntimeSize, bestGcSize, bestPtrdata int64
+	for i, r := range results {
+		var runtimeSize, gcSize, scanned int64
+		for _, t := range targets {
+			c := arrange(t, styp, r.optIdx)
+			runtimeSize += c.newRuntimeSize
+			gcSize += c.newGcSize
+			scanned += c.newPtrdata
+		}
+		better := runtimeSize < bestRuntimeSize ||
+			runtimeSize == bestRuntimeSize && (gcSize < bestGcSize || gcSize == bestGcSize && scanned < bestPtrdata)
+		if i == 0 || better {
+			best, bestRuntimeSize, bestGcSize, bestPtrdata = i, runtimeSize, gcSize, scanned
+		}
+	}
+	return results[best].optIdx
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+import "sync/atomic"
+
+type pair struct {
+	a int64
+	b int32
+}
+
+type s struct { // want `struct has size 40 \(size class 48\), could be 32 \(size class 32\), you'll save 33.33% if you rearrange it to:\nstruct {\n\tn  int64\n\tp  pair\n\tb1 bool\n\tb2 bool\n}`
+	b1 bool
+	n  int64 // want `field n is accessed atomically but is not 64-bit aligned on 32-bit platforms \(offset 4\)`
+	p  pair
+	b2 bool
+}
+
+type s1 struct {
+	ready bool
+	n     uint64 // want `field n is accessed atomically but is not 64-bit aligned on 32-bit platforms \(offset 4\)`
+}
+
+// Aligned, because it is the first word of the struct.
+type s2 struct {
+	n     uint64
+	ready bool
+}
+
+func f(v *s, v1 *s1, v2 *s2) {
+	atomic.AddInt64(&v.n, 1)
+	_ = atomic.LoadUint64(&(v1.n))
+	atomic.StoreUint64(&v2.n, 1)
+}
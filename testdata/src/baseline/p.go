@@ -0,0 +1,38 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+// Known by the baseline, though its fields moved.
+type s struct {
+	z uint32
+	y uint64
+	x uint32
+}
+
+// Known by the baseline, but sloppier than it was.
+type s1 struct { // want `struct has size 40 \(size class 48\), could be 32 \(size class 32\), you'll save 33.33% if you rearrange it to:\nstruct {\n\ty uint64\n\tw uint64\n\tx uint32\n\tz uint32\n\tb bool\n}`
+	x uint32
+	y uint64
+	z uint32
+	w uint64
+	b bool
+}
+
+// New sloppy struct.
+type s2 struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to:\nstruct {\n\tb uint64\n\ta uint32\n\tc uint32\n}`
+	a uint32
+	b uint64
+	c uint32
+}
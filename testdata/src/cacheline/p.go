@@ -0,0 +1,76 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type s struct {
+	mu    sync.Mutex
+	hits  atomic.Int64 // want `field hits \(atomic\) shares a 64 bytes cache line with field mu \(mutex\), which may cause false sharing, add 56 bytes of padding before hits or move the fields apart`
+	total uint64
+}
+
+type s1 struct {
+	reads  uint64
+	_      [56]byte
+	writes uint64
+}
+
+type s2 struct {
+	done   bool
+	_      [7]byte
+	errors int // want `field errors \(goroutine\) shares a 64 bytes cache line with field done \(goroutine\), which may cause false sharing, add 56 bytes of padding before errors or move the fields apart`
+}
+
+func f(v *s1, v2 *s2) {
+	atomic.AddUint64(&v.reads, 1)
+	atomic.AddUint64(&v.writes, 1)
+	go func() {
+		v2.done = true
+	}()
+	go func() {
+		v2.errors++
+	}()
+}
+
+// Fields accessed only by the goroutine started by one go statement do not
+// cause false sharing.
+type worker struct {
+	running int
+	count   int
+	stopped int // want `field stopped \(goroutine\) shares a 64 bytes cache line with field count \(goroutine\), which may cause false sharing, add 48 bytes of padding before stopped or move the fields apart`
+}
+
+func (w *worker) loop() {
+	for w.running > 0 {
+		w.step()
+	}
+}
+
+func (w *worker) step() {
+	w.count++
+}
+
+func stop(w *worker) {
+	w.stopped = 1
+}
+
+func start(w *worker) {
+	go w.loop()
+	go stop(w)
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+//structslop:ignore
+type s struct {
+	x uint32
+	y uint64
+	z uint32
+}
+
+type (
+	//structslop:ignore fields order matches the wire format
+	s1 struct {
+		x uint32
+		y uint64
+		z uint32
+	}
+
+	s2 struct { // want `struct has size 40 \(size class 48\), could be 32 \(size class 32\), you'll save 33.33% if you rearrange it to:\nstruct {\n\ty uint64\n\tw uint64\n\tz uint32\n\tx uint32\n\tv uint32\n}`
+		x uint32
+		y uint64
+		z uint32 //structslop:pin
+		w uint64
+		v uint32
+	}
+)
+
+// Nothing can be saved around the pinned fields.
+type s3 struct {
+	//structslop:pin
+	a bool
+	x uint64
+	b bool //structslop:pin
+}
+
+// Filling the positions around the pinned field in sorted order is not enough.
+type s4 struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to:\nstruct {\n\tc uint32\n\ta bool\n\tb bool\n\td uint16\n\te uint64\n}`
+	a bool
+	b bool
+	c uint32
+	d uint16 //structslop:pin
+	e uint64
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dep
+
+import "unsafe"
+
+type Sloppy struct {
+	A bool
+	X int64
+	B bool
+}
+
+type Wire struct {
+	A bool
+	X int64
+	B bool
+}
+
+var _ = unsafe.Offsetof(Wire{}.X)
+
+type Tight struct {
+	X int64
+	A bool
+	B bool
+}
+
+//structslop:ignore fields order matches the wire format
+type Ignored struct {
+	A bool
+	X int64
+	B bool
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import "facts/dep"
+
+// embeds is well laid out, so it is not reported for the sloppy type it holds,
+// which cannot be changed here.
+type embeds struct {
+	dep.Sloppy
+	n int64
+}
+
+type holds struct { // want `facts.holds: struct has size 88 \(size class 96\), could be 80 \(size class 80\), you'll save 16.67% if you rearrange it to:\nstruct \{\n\ts \[1\]dep.Sloppy\n\tw dep.Wire\n\ti dep.Ignored\n\tb bool\n\tc bool\n\}\nfield s holds dep.Sloppy, which has size 24 \(size class 24\), could be 16 \(size class 16\) if rearranged in its package\nfield w holds dep.Wire, which has size 24 \(size class 24\), could be 16 \(size class 16\) if rearranged in its package, but its fields order is relied upon there$`
+	b bool
+	s [1]dep.Sloppy
+	w dep.Wire
+	c bool
+	i dep.Ignored
+}
+
+// tight only holds types which are not sloppy.
+type tight struct {
+	t dep.Tight
+	n int64
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+// Pair is best with the same fields order for all its instantiations.
+type Pair[T any] struct { // want `Pair\[int64\]: struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33%\nPair\[int32\]: struct has size 12 \(size class 16\), could be 8 \(size class 8\), you'll save 50.00%\nrearrange it to:\nstruct \{\n\tx T\n\ta bool\n\tb bool\n\}`
+	a bool
+	x T
+	b bool
+}
+
+// mixed has no fields order which is best for both its instantiations.
+type mixed[K, V any] struct { // want `mixed\[int8, int32\]: struct has size 12 \(size class 16\)\nmixed\[int32, int8\]: struct has size 8 \(size class 8\)\ninstantiations disagree on the optimal order, with their own:\n\tmixed\[int8, int32\] could be 8 \(size class 8\)$`
+	k K
+	v V
+	b int8
+	s int16
+}
+
+// wide is best with an order which is optimal for none of its instantiations.
+type wide[T any] struct { // want `wide\[int16\]: struct has size 8 \(size class 8\)\nwide\[int64\]: struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33%\nrearrange it to:\nstruct \{\n\tx T\n\ta bool\n\tc int32\n\}`
+	a bool
+	x T
+	c int32
+}
+
+// Triple is not instantiated in this package.
+type Triple[T any] struct {
+	a bool
+	x T
+	b bool
+}
+
+// unused is not instantiated at all.
+type unused[T any] struct {
+	a bool
+	x T
+	b bool
+}
+
+// ok has the same layout for every instantiation.
+type ok[T any] struct {
+	x *T
+	a bool
+	b bool
+}
+
+var (
+	_ Pair[int64]
+	_ Pair[int32]
+	_ mixed[int8, int32]
+	_ mixed[int32, int8]
+	_ ok[int]
+	_ wide[int16]
+	_ wide[int64]
+)
@@ -0,0 +1,22 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package user
+
+import "generic"
+
+var (
+	_ generic.Pair[int64]   // uses the order suggested for its package
+	_ generic.Triple[int64] // want `instantiation generic.Triple\[int64\] has size 24 \(size class 24\) with the declared fields order, could be 16 \(size class 16\) with another order`
+)
@@ -0,0 +1,35 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+type s struct { // want `amd64: struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33%\n386: struct has size 16 \(size class 16\)\nrearrange it to:\nstruct {\n\ty uint64\n\tx uint32\n\tz uint32\n}`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type s1 struct { // want `amd64: struct has size 32 \(size class 32\), could be 24 \(size class 24\), you'll save 25.00%\n386: struct has size 16 \(size class 16\), could be 12 \(size class 16\)\nrearrange it to:\nstruct {\n\tp \*int\n\tq \*int\n\ta bool\n\tb bool\n}`
+	a bool
+	p *int
+	b bool
+	q *int
+}
+
+// Not sloppy on any architecture.
+type s2 struct {
+	y uint64
+	x uint32
+	z uint32
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+type s struct { // want `struct has size 40 \(size class 48\), could be 24 \(size class 24\), you'll save 50.00% if you rearrange it to:\nstruct \{\n\tn int64\n\ta bool\n\tb bool\n\td int16\n\tc int32\n\tm int64\n\}`
+	// first group
+	a bool
+	n int64
+	b bool
+
+	// second group
+	c int32
+	m int64 // trailing comment
+	d int16
+}
+
+// Nothing can be saved without moving a field to another group.
+type t struct {
+	n int64
+	a bool
+
+	m int64
+
+	b bool
+}
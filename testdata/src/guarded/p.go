@@ -0,0 +1,53 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+import "sync"
+
+type s struct { // want `struct has size 40 \(size class 48\), could be 32 \(size class 32\)`
+	a  bool
+	mu sync.Mutex
+	n  int64
+	b  bool
+
+	c int64
+}
+
+type t struct { // want `struct has size 28 \(size class 32\), could be 24 \(size class 24\) only by moving fields away from the mutexes guarding them`
+	mu1 sync.Mutex
+	a   bool
+
+	mu2 sync.Mutex
+	b   bool
+	x   int32
+}
+
+type u struct { // want `struct has size 40 \(size class 48\), could be 32 \(size class 32\)`
+	mu    sync.Mutex
+	count int32
+
+	flag  bool
+	name  string
+	ready bool // guarded by mu
+}
+
+type v struct { // want `struct has size 40 \(size class 48\), could be 32 \(size class 32\)`
+	a  bool
+	b  bool
+	c  int64
+	mu sync.Mutex
+	n  int64
+	x  bool
+}
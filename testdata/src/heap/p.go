@@ -0,0 +1,49 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heap
+
+// Allocated in slices.
+type elem struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to:\nstruct \{\n\tb int64\n\ta bool\n\tc bool\n\}\nestimated heap savings: 800 bytes over 100 allocations$`
+	a bool
+	b int64
+	c bool
+}
+
+// Allocated often, reported first.
+type hot struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to:\nstruct \{\n\tb int64\n\ta bool\n\tc bool\n\}\nestimated heap savings: 8000 bytes over 1000 allocations$`
+	a bool
+	b int64
+	c bool
+}
+
+// Allocated too rarely to be reported.
+type cold struct {
+	a bool
+	b int64
+	c bool
+}
+
+// Not allocated in the profile.
+type unused struct {
+	a bool
+	b int64
+	c bool
+}
+
+func newHot() *hot { return &hot{} }
+
+func newElems(n int) []elem { return make([]elem, n) }
+
+func newCold() *cold { return new(cold) }
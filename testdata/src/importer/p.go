@@ -0,0 +1,34 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"encoding/binary"
+	"io"
+
+	"facts/dep"
+)
+
+var (
+	_ = dep.Sloppy{true, 1, false} // want `unkeyed composite literal relies on the fields order of dep.Sloppy, which has size 24 \(size class 24\), could be 16 \(size class 16\) if rearranged in its package`
+	_ = dep.Sloppy{A: true}
+	_ = dep.Wire{true, 1, false}
+	_ = dep.Tight{1, true, false}
+	_ = dep.Ignored{true, 1, false}
+)
+
+func write(w io.Writer, s *dep.Sloppy) error {
+	return binary.Write(w, binary.LittleEndian, s) // want `passed to binary.Write relies on the fields order of dep.Sloppy`
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+type s struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type t struct { // want `struct has size 40 \(size class 48\), could be 32 \(size class 32\), you'll save 33.33% if you rearrange it to:\n(.|\n)*fields order is relied upon by:\n\t.*p.go:38:6: unkeyed composite literal$`
+	a bool
+	s
+	b bool
+	_ [4]byte
+}
+
+var (
+	_ = s{1, 2, 3}
+	_ = []*s{{1, 2, 3}, {
+		4, // x
+		5,
+		6,
+	}}
+	_ = s{x: 1, z: 3}
+	_ = t{true, s{}, false, [4]byte{}}
+	_ = struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to`
+		a bool
+		n int
+		b bool
+	}{true, 1, false}
+)
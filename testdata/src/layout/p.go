@@ -0,0 +1,36 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+type s struct { // want `current layout:\n   field  type    offset  size  align  padding\na  x      uint32  0       4     4      4\nb  y      uint64  8       8     8      0\nc  z      uint32  16      4     4      4\n 0  aaaa\.\.\.\.\n 8  bbbbbbbb\n16  cccc\.\.\.\.\noptimal layout:\n   field  type    offset  size  align  padding\na  y      uint64  0       8     8      0\nb  x      uint32  8       4     4      0\nc  z      uint32  12      4     4      0\n 0  aaaaaaaa\n 8  bbbbcccc\n`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type s1 struct { // want `struct has size 72 \(size class 80\), could be 64 \(size class 64\), you'll save 20\.00% if you rearrange it to:\nstruct \{\n\tp \*int\n\tb \[48\]byte\n\tc bool\n\td bool\n\}\ncurrent layout:\n   field  type      offset  size  align  padding\na  c      bool      0       1     1      7\nb  p      \*int      8       8     8      0\nc  b      \[48\]byte  16      48    1      0\nd  d      bool      64      1     1      7\n 0  a\.\.\.\.\.\.\.\n 8  bbbbbbbb\n16  cccccccc\n    \(5 more\)\n64  d\.\.\.\.\.\.\.\noptimal layout:\n   field  type      offset  size  align  padding\na  p      \*int      0       8     8      0\nb  b      \[48\]byte  8       48    1      0\nc  c      bool      56      1     1      0\nd  d      bool      57      1     1      6\n 0  aaaaaaaa\n 8  bbbbbbbb\n    \(5 more\)\n56  cd\.\.\.\.\.\.\n`
+	c bool
+	p *int
+	b [48]byte
+	d bool
+}
+
+// Rows of large fields are not computed one by one.
+type big struct { // want `(?s)\n        16  cccccccc\n            \(134217725 more\)\n1073741824  d\.\.\.\.\.\.\.\noptimal layout:.*\n         8  bbbbbbbb\n            \(134217725 more\)\n1073741816  cd\.\.\.\.\.\.\n$`
+	a bool
+	c int64
+	b [1<<30 - 16]byte
+	d bool
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+type s struct { // want `struct has size 40 \(size class 48\), could be 32 \(size class 32\), you'll save 33.33% if you rearrange it to:\nstruct \{\n\tb int64\n\tc int32\n\td int16\n\te int64\n\tf int16\n\ta int32\n\}\nmoved fields: a$`
+	a int32
+	b int64
+	c int32
+	d int16
+	e int64
+	f int16
+}
+
+// Fields declared together move together.
+type u struct { // want `struct has size 32 \(size class 32\), could be 24 \(size class 24\), you'll save 25.00% if you rearrange it to:\nstruct \{\n\ti int64\n\tj int64\n\tb bool\n\ta bool\n\}\nmoved fields: a$`
+	a    bool
+	i, j int64
+	b    bool
+}
+
+type t struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to:\nstruct \{\n\ty uint64\n\tz uint32\n\tx uint32\n\}\nmoved fields: x$`
+	x uint32
+	y uint64
+	z uint32
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package names
+
+type T struct { // want `^names.T: struct has size`
+	a bool
+	x int64
+	b bool
+
+	inner struct { // want `^names.T.inner: struct has size`
+		a bool
+		x int32
+		b bool
+	}
+}
+
+type A = struct { // want `^names.A: struct has size`
+	a bool
+	x int64
+	b bool
+}
+
+var v struct { // want `^names.v: struct has size`
+	a bool
+	x int64
+	b bool
+}
+
+func F() {
+	type local struct { // want `^names.F.local: struct has size`
+		a bool
+		x int64
+		b bool
+	}
+	_ = func() {
+		var x struct { // want `^names.F.func1.x: struct has size`
+			a bool
+			x int64
+			b bool
+		}
+		_ = x
+		_ = func() {
+			var y struct { // want `^names.F.func1.1.y: struct has size`
+				a bool
+				x int64
+				b bool
+			}
+			_ = y
+		}
+	}
+	_ = func() {
+		var z struct { // want `^names.F.func2.z: struct has size`
+			a bool
+			x int64
+			b bool
+		}
+		_ = z
+	}
+	_ = local{}
+}
+
+var g = func() {
+	var x struct { // want `^names.init.func1.x: struct has size`
+		a bool
+		x int64
+		b bool
+	}
+	_ = x
+}
+
+func (*T) M() {
+	type local struct { // want `^names.T.M.local: struct has size`
+		a bool
+		x int64
+		b bool
+	}
+	_ = local{}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package narrow
+
+import "time"
+
+type task struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\) with narrower field types:\n\tstate: int8 instead of int, only set to and compared with constants from 0 to 3\n\tretry, queued: bit flags in a uint8 instead of bool fields$`
+	id     int64
+	state  int
+	retry  bool
+	queued bool
+}
+
+func newTask(id int64) *task {
+	return &task{id: id, queued: true}
+}
+
+func (t *task) run() {
+	t.state = 1
+	switch t.state {
+	case 2:
+		t.retry = true
+	}
+	if t.state == 3 {
+		t.queued = false
+	}
+}
+
+type session struct { // want `struct has size 56 \(size class 64\), could be 40 \(size class 48\), you'll save 25.00% if you rearrange it to:\nstruct \{\n\tcreated time.Time\n\thits    int64\n\tkind    int32\n\tactive  bool\n\texpired bool\n\}\nwith narrower field types, it could be 24 \(size class 24\):\n\tactive, expired: bit flags in a uint8 instead of bool fields\n\tcreated: int64 instead of time.Time, only used through Before\n\tkind: int8 instead of int32, only set to and compared with constants from 0 to 2$`
+	active  bool
+	created time.Time
+	expired bool
+	hits    int64
+	kind    int32
+}
+
+func newSession() *session {
+	return &session{created: time.Now(), kind: 1}
+}
+
+func (s *session) hit(now time.Time) {
+	s.hits++
+	if s.created.Before(now) {
+		s.expired = true
+	}
+	s.kind = 2
+}
+
+// Fields set to variables cannot be narrowed.
+type counter struct {
+	n     int
+	limit int64
+	a, b  bool
+}
+
+func (c *counter) set(n int) {
+	c.n = n
+	c.a = &c.b != nil
+}
+
+type state int
+
+const (
+	idle state = iota
+	running
+	stopped
+)
+
+// Named integer types are narrowed through their underlying type.
+type job struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\) with narrower field types:\n\tst: type state int8 instead of int, only set to and compared with constants from 0 to 2$`
+	st   state
+	id   int64
+	done bool
+}
+
+func (j *job) stop() {
+	if j.st == running {
+		j.st = stopped
+		j.done = true
+	}
+}
+
+// Fields used in arithmetic are not narrowed, as narrower types could overflow.
+type scaled struct {
+	level int
+	id    int64
+	on    bool
+}
+
+func (s *scaled) weight() int {
+	s.level = 3
+	return s.level * 1000
+}
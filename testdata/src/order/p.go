@@ -0,0 +1,93 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unsafe"
+
+	"order/codec"
+)
+
+type unkeyed struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you.ll save 33.33% if you rearrange it to:\nstruct \{\n\ty uint64\n\tx uint32\n\tz uint32\n\}\n$`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type keyed struct { // want `struct has size 24 \(size class 24\), could be 16`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type wire struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you.ll save 33.33% if you rearrange it to:\nstruct \{\n\ty uint64\n\tx uint32\n\tz uint32\n\}\nfields order is relied upon by:\n\t.*p.go:78:46: passed to binary.Write\n\t.*p.go:79:18: passed to binary.Size`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type offset struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you.ll save 33.33% if you rearrange it to:\nstruct \{\n\ty uint64\n\tx uint32\n\tz uint32\n\}\nfields order is relied upon by:\n\t.*p.go:80:6: unsafe.Offsetof`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type mirror struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you.ll save 33.33% if you rearrange it to:\nstruct \{\n\ty uint64\n\tx uint32\n\tz uint32\n\}\nfields order is relied upon by:\n\t.*p.go:83:6: converted through unsafe.Pointer`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type cmirror struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you.ll save 33.33% if you rearrange it to:\nstruct \{\n\ty uint64\n\tx uint32\n\tz uint32\n\}\nfields order is relied upon by:\n\t.*p.go:83:6: converted through unsafe.Pointer`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type asm struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you.ll save 33.33% if you rearrange it to:\nstruct \{\n\ty uint64\n\tx uint32\n\tz uint32\n\}\nfields order is relied upon by:\n\t.*p.go:88:1: passed to assembly function sum$`
+	x uint32
+	y uint64
+	z uint32
+}
+
+type imported struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you.ll save 33.33% if you rearrange it to:\nstruct \{\n\ty uint64\n\tx uint32\n\tz uint32\n\}\nfields order is relied upon by:\n\t.*p.go:84:24: passed to codec.Write`
+	x uint32
+	y uint64
+	z uint32
+}
+
+func f() {
+	_ = unkeyed{1, 2, 3}
+	_ = keyed{x: 1, y: 2, z: 3}
+
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, &wire{})
+	_ = binary.Size([]wire{})
+	_ = unsafe.Offsetof(offset{}.z)
+
+	var m mirror
+	_ = (*cmirror)(unsafe.Pointer(&m))
+	_ = codec.Write(&buf, imported{})
+}
+
+// sum is implemented in assembly.
+func sum(a *asm) uint64
+
+// load is pulled in from another package, not implemented in assembly.
+//
+//go:linkname load runtime.load
+func load(a *asm) uint64
@@ -0,0 +1,34 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skip
+
+import "encoding/binary"
+
+type wire struct {
+	x uint32
+	y uint64
+	z uint32
+}
+
+type unkeyed struct { // want `struct has size 24 \(size class 24\), could be 16`
+	x uint32
+	y uint64
+	z uint32
+}
+
+var (
+	_ = binary.Size(wire{})
+	_ = unkeyed{1, 2, 3}
+)
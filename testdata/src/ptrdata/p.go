@@ -0,0 +1,47 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p
+
+// Same size class, but the GC only needs to scan the pointer.
+type s struct { // want `struct has size 16 \(size class 16\), GC scans 16 bytes, could scan 8 if you rearrange it to:\nstruct {\n\tp \*int\n\tx uint64\n}`
+	x uint64
+	p *int
+}
+
+type s1 struct { // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33%, GC scans 16 bytes, could scan 8 if you rearrange it to:\nstruct {\n\tp \*int\n\tx uint32\n\ty uint32\n}`
+	x uint32
+	p *int
+	y uint32
+}
+
+// The array keeps its pointer-free tail last.
+type s2 struct { // want `struct has size 80 \(size class 80\), GC scans 72 bytes, could scan 56 if you rearrange it to:\nstruct {\n\tstr string\n\ta   \[2\]struct {\n\t\tp \*int\n\t\tn \[3\]int\n\t}\n}`
+	a [2]struct {
+		p *int
+		n [3]int
+	}
+	str string
+}
+
+type s3 struct {
+	p *int
+	x uint64
+}
+
+// No pointers.
+type s4 struct {
+	x uint64
+	y uint64
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recursive
+
+import "unsafe"
+
+// Rearranging inner alone keeps its size class.
+type inner struct {
+	a int32
+	x int64
+	b int32
+	y int64
+	c int64
+	d int64
+}
+
+type outer struct { // want `struct has size 56 \(size class 64\), could be 48 \(size class 48\), you'll save 25.00% if you rearrange it to:\nstruct \{\n\tin inner\n\tn  int64\n\}\nwith nested structs rearranged: inner$`
+	in inner
+	n  int64
+}
+
+type config struct { // want `struct has size 56 \(size class 64\), could be 48 \(size class 48\), you'll save 25.00% if you rearrange it to:\nstruct \{\n\tlimits struct \{\n\t\tx int64\n\t\ty int64\n\t\tc int64\n\t\td int64\n\t\ta int32\n\t\tb int32\n\t\}\n\tn int64\n\}\nwith nested structs rearranged: limits$`
+	limits struct {
+		a int32
+		x int64
+		b int32
+		y int64
+		c int64
+		d int64
+	}
+	n int64
+}
+
+// Structs whose order is relied upon keep it.
+type wire struct {
+	a int32
+	x int64
+	b int32
+	y int64
+	c int64
+	d int64
+}
+
+type packet struct {
+	w wire
+	n int64
+}
+
+var _ = unsafe.Offsetof(wire{}.x)
+
+// Generic structs are checked with their instantiations, and not rearranged with
+// the structs holding them.
+type G[T any] struct { // want `G\[int64\]: struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33%\nrearrange it to:\nstruct \{\n\tx T\n\ta bool\n\tb bool\n\}`
+	a bool
+	x T
+	b bool
+}
+
+type holder struct {
+	g G[int64]
+	n int64
+}
+
+var _ G[int64]
@@ -87,3 +87,8 @@ type s10 struct { // want `struct has size 40 \(size class 48\), could be 24 \(s
 	a3     [3]bool // a3 is array of bool
 	_      [0]func()
 }
+
+// One-line structs.
+type (
+	s11 struct{ a bool; b int64; c bool } // want `struct has size 24 \(size class 24\), could be 16 \(size class 16\), you'll save 33.33% if you rearrange it to:\nstruct {\n\tb int64\n\ta bool\n\tc bool\n}`
+)
@@ -0,0 +1,41 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thresholds
+
+// Saves too few bytes.
+type small struct {
+	a bool
+	x int64
+	b bool
+}
+
+// Too small for the threshold of this package.
+type medium struct {
+	a bool
+	x int64
+	b bool
+	y int64
+	c bool
+}
+
+type large struct { // want `struct has size 56 \(size class 64\), could be 32 \(size class 32\), you'll save 50.00% if you rearrange it to:\nstruct \{\n\tx int64\n\ty int64\n\tz int64\n\ta bool\n\tb bool\n\tc bool\n\td bool\n\}\n$`
+	a bool
+	x int64
+	b bool
+	y int64
+	c bool
+	z int64
+	d bool
+}
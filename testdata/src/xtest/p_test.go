@@ -0,0 +1,21 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xtest_test
+
+import "xtest"
+
+// The literal is in the external test package, which the analysis of the
+// package declaring Point cannot see.
+var _ = xtest.Point{true, 1, false} // want `unkeyed composite literal relies on the fields order of xtest.Point`
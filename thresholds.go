@@ -0,0 +1,119 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// thresholdFlag is a minimum value, which may depend on the package, like -gcflags:
+// every value is either given alone, for all packages, or as pattern=value, for
+// the packages matching the pattern, and the last matching value wins. Patterns
+// are import paths, where "..." matches any string. Setting it to an empty
+// string removes all values.
+type thresholdFlag struct {
+	integer bool
+	values  []string
+	entries []thresholdEntry
+}
+
+type thresholdEntry struct {
+	pattern *regexp.Regexp // nil for all packages
+	value   float64
+}
+
+func (f *thresholdFlag) String() string {
+	return strings.Join(f.values, " ")
+}
+
+func (f *thresholdFlag) Set(s string) error {
+	if s == "" {
+		f.values, f.entries = nil, nil
+		return nil
+	}
+	var e thresholdEntry
+	text := s
+	if i := strings.LastIndex(s, "="); i >= 0 {
+		if i == 0 {
+			return fmt.Errorf("missing package pattern in %q", s)
+		}
+		e.pattern = packagePattern(s[:i])
+		text = s[i+1:]
+	}
+	var err error
+	if f.integer {
+		var n int64
+		n, err = strconv.ParseInt(text, 10, 64)
+		e.value = float64(n)
+	} else {
+		e.value, err = strconv.ParseFloat(text, 64)
+	}
+	if err != nil || e.value < 0 {
+		return fmt.Errorf("invalid threshold %q", s)
+	}
+	f.values = append(f.values, s)
+	f.entries = append(f.entries, e)
+	return nil
+}
+
+// value returns the threshold of the package with the given import path.
+func (f *thresholdFlag) value(pkg string) float64 {
+	for i := len(f.entries) - 1; i >= 0; i-- {
+		if e := f.entries[i]; e.pattern == nil || e.pattern.MatchString(pkg) {
+			return e.value
+		}
+	}
+	return 0
+}
+
+// packagePattern returns the regexp matching the import paths matched by pattern,
+// where "..." matches any string, and "x/..." also matches "x", like go list does.
+func packagePattern(pattern string) *regexp.Regexp {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	return regexp.MustCompile(`^` + re + `$`)
+}
+
+// meetsThresholds reports whether r saves at least -min-bytes and -min-percent of
+// the size class, or of the GC scanned bytes, of a struct of at least -min-size
+// bytes of the package with the given import path.
+func meetsThresholds(r result, pkg string) bool {
+	if float64(r.oldGcSize) < minSize.value(pkg) {
+		return false
+	}
+	bytes, percent := minBytes.value(pkg), minPercent.value(pkg)
+	if saved := r.oldRuntimeSize - r.newRuntimeSize; saved > 0 && float64(saved) >= bytes && r.savings() >= percent {
+		return true
+	}
+	saved := r.oldPtrdata - r.newPtrdata
+	return saved > 0 && float64(saved) >= bytes && float64(saved)/float64(r.oldPtrdata)*100 >= percent
+}
+
+// worthReporting reports whether a struct is sloppy on some target, by at least
+// the thresholds of the package with the given import path.
+func worthReporting(results []result, pkg string) bool {
+	for _, r := range results {
+		if r.sloppy() && meetsThresholds(r, pkg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 Orijtech, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structslop
+
+import (
+	"testing"
+)
+
+func TestThresholdFlag(t *testing.T) {
+	f := thresholdFlag{integer: true}
+	for _, s := range []string{"8", "example.com/...=16", "example.com/x=32"} {
+		if err := f.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		pkg  string
+		want float64
+	}{
+		{"other.com/x", 8},
+		{"example.com", 16},
+		{"example.com/y", 16},
+		{"example.com/x", 32},
+		{"example.com/x/y", 16},
+		{"example.comx", 8},
+	}
+	for _, tt := range tests {
+		if got := f.value(tt.pkg); got != tt.want {
+			t.Errorf("value(%q) = %v, want %v", tt.pkg, got, tt.want)
+		}
+	}
+	for _, s := range []string{"=8", "x", "1.5", "-1"} {
+		if err := f.Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded", s)
+		}
+	}
+	if err := f.Set(""); err != nil || f.value("example.com/x") != 0 {
+		t.Error("Set(\"\") did not reset the flag")
+	}
+}